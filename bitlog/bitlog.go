@@ -31,6 +31,7 @@ package bitlog
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -38,9 +39,15 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/Panda-Home/bitcask/metrics"
 	"github.com/Panda-Home/bitcask/utils"
 )
 
+var (
+	bytesWritten = metrics.NewCounter("bitcask_log_bytes_written_total", "Bytes written to data files.")
+	rotations    = metrics.NewCounter("bitcask_log_rotations_total", "Number of data file rotations.")
+)
+
 // Logger ...
 type Logger struct {
 	Dirpath string
@@ -101,12 +108,69 @@ func (l *Logger) Write(b []byte) (n int, err error) {
 	if err == nil {
 		l.curFilePos += byteLen
 	}
+	bytesWritten.Add(float64(n))
 	return n, err
 }
 
-// Close ...
-func (l *Logger) Close() {
-	l.fileHandler.Close()
+// WriteFrom copies size bytes from r to active file, so that large
+// records don't have to be held in memory. Nothing is left in the
+// file if r fails or ends early.
+func (l *Logger) WriteFrom(r io.Reader, size int64) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if size+l.curFilePos >= l.maxSize() {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := io.Copy(l.fileHandler, io.LimitReader(r, size))
+	if err == nil && n != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		if terr := l.fileHandler.Truncate(l.curFilePos); terr != nil {
+			return 0, fmt.Errorf("Failed to roll back write: %s", terr)
+		}
+		l.fileHandler.Seek(l.curFilePos, 0)
+		return 0, err
+	}
+	l.curFilePos += n
+	bytesWritten.Add(float64(n))
+	return n, nil
+}
+
+// Close flushes the active file to disk and closes it
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.fileHandler.Sync(); err != nil {
+		l.fileHandler.Close()
+		return fmt.Errorf("Failed to sync logfile: %s", err)
+	}
+	return l.fileHandler.Close()
+}
+
+// Truncate cuts the active file to given size. It's meant to drop
+// the broken tail left by an interrupted write before appending.
+func (l *Logger) Truncate(size int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if size > l.curFilePos {
+		return fmt.Errorf("Can't truncate file of %d bytes to %d bytes", l.curFilePos, size)
+	}
+	if err := l.fileHandler.Truncate(size); err != nil {
+		return fmt.Errorf("Failed to truncate logfile: %s", err)
+	}
+	// New files aren't opened in append mode
+	if _, err := l.fileHandler.Seek(size, 0); err != nil {
+		return fmt.Errorf("Failed to seek logfile: %s", err)
+	}
+	l.curFilePos = size
+	return nil
 }
 
 // SeekLog moves file handler to given pos relative to
@@ -191,6 +255,7 @@ func (l *Logger) rotate() error {
 	l.filepath = newFilepath
 	l.fileHandler = f
 	l.curFilePos = 0
+	rotations.Inc()
 	return nil
 }
 
@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -85,6 +86,44 @@ func Test_SeekLog(t *testing.T) {
 	assert.Nil(t, err, "Expected no error on seeking to a head of EOF")
 }
 
+func Test_Truncate(t *testing.T) {
+	defer cleanup()
+
+	logger, err := NewLogger(fakeDir, 1, false)
+	defer logger.Close()
+	assert.Nil(t, err, "Expected no error on log file creation")
+	logger.Write([]byte("Hello world!"))
+
+	err = logger.Truncate(int64(20))
+	assert.Error(t, err, "Expected an error on truncating beyond file size")
+	err = logger.Truncate(int64(5))
+	assert.Nil(t, err, "Expected no error on truncating")
+	assert.Equal(t, int64(5), logger.ActiveFilePos(), fmt.Sprintf("Expected pointing at %d, but pointing at %d", int64(5), logger.ActiveFilePos()))
+
+	logger.Write([]byte(" there"))
+	content, _ := ioutil.ReadFile(logger.ActiveFilepath())
+	assert.Equal(t, "Hello there", string(content), "Expected writes to continue from truncated size")
+}
+
+func Test_WriteFrom(t *testing.T) {
+	defer cleanup()
+
+	logger, err := NewLogger(fakeDir, 1, false)
+	defer logger.Close()
+	assert.Nil(t, err, "Expected no error on log file creation")
+	logger.Write([]byte("Hello"))
+
+	n, err := logger.WriteFrom(strings.NewReader(" world!"), 7)
+	assert.Nil(t, err, "Expected no error on writing from reader")
+	assert.Equal(t, int64(7), n)
+
+	_, err = logger.WriteFrom(strings.NewReader(" again"), 10)
+	assert.Error(t, err, "Expected an error on short reader")
+	assert.Equal(t, int64(12), logger.ActiveFilePos(), "Expected position to be unchanged after failed write")
+	content, _ := ioutil.ReadFile(logger.ActiveFilepath())
+	assert.Equal(t, "Hello world!", string(content), "Expected failed write to be rolled back")
+}
+
 func cleanup() {
 	os.RemoveAll(fakeDir)
 }
@@ -27,20 +27,78 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 )
 
+// DefaultMaxValueSize is the max size of values when
+// max_value_size_in_bytes isn't set
+const DefaultMaxValueSize = 512 * 1024 * 1024
+
 // BitcaskConfig is the configuration file used by Bitcask
 // in json format.
 type BitcaskConfig struct {
 	Host      string `json:"host"`
-	Port      int    `json:"port"`
+	Port      int    `json:"port"` // TCP is disabled when 0 and unix_socket is set
 	PidFile   string `json:"pidfile"`
 	DataDir   string `json:"data_directory"`
 	DataSize  int    `json:"data_filesize_in_mb"`        // data file rotate size in MB
 	MergeFreq int    `json:"merge_frequency_in_seconds"` // in seconds
+	HTTPPort  int    `json:"http_port"`                  // serves /metrics, disabled when 0
+	ReadOnly  bool   `json:"read_only"`                  // serves reads without modifying data files
+	LogLevel  string `json:"log_level"`                  // debug, info, warn or error
+	LogFormat string `json:"log_format"`                 // text or json
+	LogFile   string `json:"log_file"`                   // stderr when empty
+
+	SlowlogThreshold int `json:"slowlog_threshold_in_microseconds"` // negative disables slowlog
+	SlowlogMaxLen    int `json:"slowlog_max_len"`
+
+	MaxValueSize int64 `json:"max_value_size_in_bytes"` // at most 4 GiB - 1
+
+	Compression          string `json:"compression"`                    // none, flate or gzip
+	CompressionThreshold int    `json:"compression_threshold_in_bytes"` // smaller values aren't compressed
+
+	EncryptionKeyFile     string   `json:"encryption_key_file"`      // 32 bytes key in hex, no encryption when empty
+	OldEncryptionKeyFiles []string `json:"old_encryption_key_files"` // keys replaced by encryption_key_file
+
+	MaxClients   int `json:"max_clients"`              // no limit when 0
+	IdleTimeout  int `json:"idle_timeout_in_seconds"`  // idle connections are kept when 0
+	WriteTimeout int `json:"write_timeout_in_seconds"` // 30 by default, negative disables it
+
+	ShutdownGracePeriod int `json:"shutdown_grace_period_in_seconds"` // 10 by default, negative doesn't wait
+
+	ReplicaOf          string `json:"replica_of"` // host:port of the primary, this server is a replica when set
+	ReplicaUser        string `json:"replica_user"`
+	ReplicaPassword    string `json:"replica_password"`
+	ReplicationBacklog int    `json:"replication_backlog_len"` // writes kept for replicas to resume from
+
+	ReplicaTLS           bool   `json:"replica_tls"`             // connect to the primary over TLS
+	ReplicaTLSCAFile     string `json:"replica_tls_ca_file"`     // CAs the primary is verified with, system ones when empty
+	ReplicaTLSCertFile   string `json:"replica_tls_cert_file"`   // client certificate, for primaries requiring one
+	ReplicaTLSKeyFile    string `json:"replica_tls_key_file"`    // required along with replica_tls_cert_file
+	ReplicaTLSServerName string `json:"replica_tls_server_name"` // host of replica_of when empty
+
+	UnixSocket            string `json:"unix_socket"`             // path of a Unix socket to listen on
+	UnixSocketPermissions string `json:"unix_socket_permissions"` // in octal, 0660 when empty
+
+	TLSCertFile     string `json:"tls_cert_file"`      // TLS is enabled when set
+	TLSKeyFile      string `json:"tls_key_file"`       // required along with tls_cert_file
+	TLSMinVersion   string `json:"tls_min_version"`    // 1.0 to 1.3, 1.2 when empty
+	TLSClientCAFile string `json:"tls_client_ca_file"` // client certificates are required when set
+
+	Users []UserConfig `json:"users"` // authentication is disabled when empty
+}
+
+// UserConfig describes a user allowed to run commands once
+// authenticated
+type UserConfig struct {
+	Name         string   `json:"name"`
+	PasswordHash string   `json:"password_hash"` // printed by bitcask -hash-password
+	Categories   []string `json:"categories"`    // read, write and admin
+	KeyPrefixes  []string `json:"key_prefixes"`  // all keys when empty
 }
 
 // NewBitcaskConfig reads the config file and converts its content
@@ -65,5 +123,32 @@ func NewBitcaskConfig(configFile string) (*BitcaskConfig, error) {
 	if c.MergeFreq == 0 {
 		c.MergeFreq = 3600 // by default run merge process every hour
 	}
+	if c.SlowlogThreshold == 0 {
+		c.SlowlogThreshold = 10000 // 10 milliseconds
+	}
+	if c.SlowlogMaxLen == 0 {
+		c.SlowlogMaxLen = 128
+	}
+	if c.SlowlogMaxLen < 0 {
+		return nil, errors.New("slowlog_max_len cannot be negative")
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = 30
+	}
+	if c.ReplicationBacklog == 0 {
+		c.ReplicationBacklog = 100000
+	}
+	if c.ShutdownGracePeriod == 0 {
+		c.ShutdownGracePeriod = 10
+	}
+	if c.CompressionThreshold == 0 {
+		c.CompressionThreshold = 1024
+	}
+	if c.MaxValueSize == 0 {
+		c.MaxValueSize = DefaultMaxValueSize
+	}
+	if c.MaxValueSize < 0 || c.MaxValueSize > math.MaxUint32 {
+		return nil, fmt.Errorf("max_value_size_in_bytes must be between 1 and %d", uint32(math.MaxUint32))
+	}
 	return &c, nil
 }
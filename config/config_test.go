@@ -26,6 +26,7 @@ package config
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -35,6 +36,8 @@ import (
 var (
 	testConfigFile       = "/tmp/test_config.json"
 	testBrokenConfigFile = "/tmp/test_broken_config.json"
+
+	testNegativeSlowlogConfigFile = "/tmp/test_negative_slowlog_config.json"
 )
 
 func Test_NewBitcaskConfig(t *testing.T) {
@@ -47,6 +50,9 @@ func Test_NewBitcaskConfig(t *testing.T) {
 	_, err = NewBitcaskConfig(testBrokenConfigFile)
 	assert.Error(t, err, "Expected an error on broken json config")
 
+	_, err = NewBitcaskConfig(testNegativeSlowlogConfigFile)
+	assert.EqualError(t, err, "slowlog_max_len cannot be negative")
+
 	c, err := NewBitcaskConfig(testConfigFile)
 	assert.Nil(t, err, "Expected no error on normal config file")
 	assert.Equal(t, "localhost", c.Host, fmt.Sprintf("Expected host: %s, got: %s", "localhost", c.Host))
@@ -55,6 +61,10 @@ func Test_NewBitcaskConfig(t *testing.T) {
 	assert.Equal(t, "/usr/local/var/bitcask", c.DataDir, fmt.Sprintf("Expected data directory: %s, got: %s", "/usr/local/var/bitcask", c.DataDir))
 	assert.Equal(t, 1, c.DataSize, fmt.Sprintf("Expected data size (MB): %d, got: %d", 1, c.DataSize))
 	assert.Equal(t, 10, c.MergeFreq, fmt.Sprintf("Expected merger frequency (second): %d, got: %d", 10, c.MergeFreq))
+	assert.Equal(t, 10000, c.SlowlogThreshold, fmt.Sprintf("Expected default slowlog threshold (microsecond): %d, got: %d", 10000, c.SlowlogThreshold))
+	assert.Equal(t, 128, c.SlowlogMaxLen, fmt.Sprintf("Expected default slowlog length: %d, got: %d", 128, c.SlowlogMaxLen))
+	assert.Equal(t, 1024, c.CompressionThreshold, fmt.Sprintf("Expected default compression threshold: %d, got: %d", 1024, c.CompressionThreshold))
+	assert.Equal(t, int64(512*1024*1024), c.MaxValueSize, fmt.Sprintf("Expected default max value size: %d, got: %d", 512*1024*1024, c.MaxValueSize))
 }
 
 func prepareConfigFile() {
@@ -80,9 +90,12 @@ func prepareConfigFile() {
 	"data_directory": "/usr/local/var/bitcask",
 	"data_filesize_in_mb": 1,
 	"merge_frequency_in_seconds": 10`))
+
+	ioutil.WriteFile(testNegativeSlowlogConfigFile, []byte(`{"slowlog_max_len": -1}`), 0644)
 }
 
 func cleanupFile() {
 	os.Remove(testConfigFile)
 	os.Remove(testBrokenConfigFile)
+	os.Remove(testNegativeSlowlogConfigFile)
 }
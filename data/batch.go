@@ -0,0 +1,218 @@
+package data
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Panda-Home/bitcask/utils"
+)
+
+// batchCommitKey is the key of commit records. Commit records are
+// told apart by FlagBatchCommit, the key is only there because
+// entries can't have an empty one.
+var batchCommitKey = []byte("bitcask:batch:commit")
+
+// DumpBatch serializes entries as one batch: every entry is flagged
+// with FlagBatch and a commit record holding the number of entries
+// follows them. The result is meant to be written with a single
+// write, readers ignore the batch unless its commit record is there.
+func DumpBatch(entries []*Entry) ([]byte, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("Batch cannot be empty")
+	}
+
+	var batchBytes []byte
+	for _, entry := range entries {
+		entry.Flags |= FlagBatch
+		entryBytes, err := entry.Dump()
+		if err != nil {
+			return nil, err
+		}
+		batchBytes = append(batchBytes, entryBytes...)
+	}
+
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, uint32(len(entries)))
+	commit := &Entry{
+		Timestamp: utils.MakeTimestampInMS(),
+		Flags:     FlagBatchCommit,
+		KeySize:   uint32(len(batchCommitKey)),
+		ValueSize: uint32(len(count)),
+		Key:       batchCommitKey,
+		Value:     count,
+	}
+	commitBytes, err := commit.Dump()
+	if err != nil {
+		return nil, err
+	}
+	return append(batchBytes, commitBytes...), nil
+}
+
+// ReadEntries calls fn on each committed entry of f, in file order,
+// with the position of the entry. Entries of a batch are only passed
+// once its commit record is read, with FlagBatch cleared. Commit
+// records themselves are never passed.
+//
+// Reading stops at the first entry which can't be loaded, which is
+// what the tail of a file looks like after an interrupted write. The
+// returned offset is the end of the last committed entry, anything
+// after it is either broken or part of an uncommitted batch, see
+// CheckTail.
+func ReadEntries(f *os.File, fn func(entry *Entry, pos int64) error) (int64, error) {
+	type pendingEntry struct {
+		entry *Entry
+		pos   int64
+	}
+	var (
+		curPos    int64
+		committed int64
+		pending   []pendingEntry
+	)
+	for {
+		entry, err := LoadFromFile(f, curPos)
+		if err != nil {
+			return committed, nil
+		}
+		pos := curPos
+		curPos += entry.Size()
+
+		switch {
+		case entry.Flags&FlagBatchCommit != 0:
+			if entry.ValueSize != 4 || binary.BigEndian.Uint32(entry.Value) != uint32(len(pending)) {
+				// commit record doesn't close the batch read so far
+				return committed, nil
+			}
+			for _, p := range pending {
+				p.entry.Flags &^= FlagBatch
+				if err := fn(p.entry, p.pos); err != nil {
+					return committed, err
+				}
+			}
+			pending = pending[:0]
+			committed = curPos
+		case entry.Flags&FlagBatch != 0:
+			pending = append(pending, pendingEntry{entry, pos})
+		default:
+			// a batch interrupted by another write is never committed
+			pending = pending[:0]
+			if err := fn(entry, pos); err != nil {
+				return committed, err
+			}
+			committed = curPos
+		}
+	}
+}
+
+// CheckTail makes sure the bytes of f after end, as returned by
+// ReadEntries, are what an interrupted write leaves behind: entries of
+// a batch missing its commit record, possibly followed by one entry
+// cut short by the end of the file, or zeros left by a file extended
+// before being written to. Anything else is corruption, and an error
+// giving the offset of the first entry which can't be loaded is
+// returned.
+func CheckTail(f *os.File, end int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	header := make([]byte, HeaderSize)
+	for pos := end; pos < size; {
+		if size-pos < HeaderSize {
+			return nil
+		}
+		if _, err := f.ReadAt(header, pos); err != nil {
+			return err
+		}
+		entrySize := int64(HeaderSize) + int64(binary.BigEndian.Uint32(header[96:128])) + int64(binary.BigEndian.Uint32(header[128:160]))
+		if pos+entrySize > size {
+			return nil
+		}
+		entry, err := LoadFromFile(f, pos)
+		if err != nil {
+			if zeros, zerr := isZeroFrom(f, pos, size); zerr != nil || zeros {
+				return zerr
+			}
+			return fmt.Errorf("Broken entry at offset %d", pos)
+		}
+		if entry.Flags&FlagBatch == 0 {
+			return fmt.Errorf("Unexpected entry at offset %d, after a batch missing its commit record", pos)
+		}
+		pos += entrySize
+	}
+	return nil
+}
+
+// isZeroFrom tells if every byte of f from pos to size is zero
+func isZeroFrom(f *os.File, pos, size int64) (bool, error) {
+	buf := make([]byte, 64*1024)
+	for pos < size {
+		n := int64(len(buf))
+		if size-pos < n {
+			n = size - pos
+		}
+		if _, err := f.ReadAt(buf[:n], pos); err != nil {
+			return false, err
+		}
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		pos += n
+	}
+	return true, nil
+}
+
+// LoadEntries calls fn on each entry serialized in b, as written to
+// data files, with its offset in b. Unlike ReadEntries, batch entries
+// and commit records are passed as they are, and an entry which can't
+// be loaded is an error.
+func LoadEntries(b []byte, fn func(entry *Entry, offset int64) error) error {
+	var offset int64
+	for offset < int64(len(b)) {
+		rest := b[offset:]
+		if len(rest) < HeaderSize {
+			return fmt.Errorf("Truncated entry at offset %d", offset)
+		}
+		size := int64(HeaderSize) + int64(binary.BigEndian.Uint32(rest[96:128])) + int64(binary.BigEndian.Uint32(rest[128:160]))
+		if size > int64(len(rest)) {
+			return fmt.Errorf("Truncated entry at offset %d", offset)
+		}
+		entry, err := LoadFromBytes(rest[:size])
+		if err != nil {
+			return fmt.Errorf("Invalid entry at offset %d", offset)
+		}
+		if err := fn(entry, offset); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package data
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var batchFilePath = "/tmp/bitcask_batch_test.bit"
+
+func Test_DumpBatch(t *testing.T) {
+	_, err := DumpBatch(nil)
+	assert.Error(t, err, "Expected an error on empty batch")
+
+	e1, _ := NewEntry([]byte("k1"), []byte("v1"))
+	e2, _ := NewEntry([]byte("k2"), nil)
+	batchBytes, err := DumpBatch([]*Entry{e1, e2})
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, int(e1.Size()+e2.Size())+HeaderSize+len(batchCommitKey)+4, len(batchBytes), "Expected entries followed by a commit record")
+
+	loaded, _ := LoadFromBytes(batchBytes[:e1.Size()])
+	assert.Equal(t, FlagBatch, loaded.Flags, "Expected batch flag on batch entries")
+}
+
+func Test_ReadEntries(t *testing.T) {
+	defer os.Remove(batchFilePath)
+
+	single, _ := NewEntry([]byte("single"), []byte("v"))
+	singleBytes, _ := single.Dump()
+	b1, _ := NewEntry([]byte("b1"), []byte("v1"))
+	b2, _ := NewEntry([]byte("b2"), []byte("v2"))
+	batchBytes, _ := DumpBatch([]*Entry{b1, b2})
+	torn1, _ := NewEntry([]byte("torn1"), []byte("v"))
+	torn2, _ := NewEntry([]byte("torn2"), []byte("v"))
+	tornBytes, _ := DumpBatch([]*Entry{torn1, torn2})
+	tornBytes = tornBytes[:len(tornBytes)-10] // commit record is cut
+
+	f, _ := os.OpenFile(batchFilePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	defer f.Close()
+	f.Write(singleBytes)
+	f.Write(batchBytes)
+	f.Write(tornBytes)
+
+	var keys []string
+	var positions []int64
+	end, err := ReadEntries(f, func(entry *Entry, pos int64) error {
+		assert.Equal(t, uint8(0), entry.Flags, "Expected batch flag to be cleared")
+		keys = append(keys, string(entry.Key))
+		positions = append(positions, pos)
+		return nil
+	})
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, []string{"single", "b1", "b2"}, keys, "Expected entries of the torn batch to be skipped")
+	assert.Equal(t, []int64{0, single.Size(), single.Size() + b1.Size()}, positions)
+	assert.Equal(t, int64(len(singleBytes)+len(batchBytes)), end, "Expected end of the last committed record")
+}
+
+func Test_LoadEntries(t *testing.T) {
+	single, _ := NewEntry([]byte("single"), []byte("v"))
+	singleBytes, _ := single.Dump()
+	b1, _ := NewEntry([]byte("b1"), []byte("v1"))
+	batchBytes, _ := DumpBatch([]*Entry{b1})
+	all := append(singleBytes, batchBytes...)
+
+	var keys []string
+	var offsets []int64
+	err := LoadEntries(all, func(entry *Entry, offset int64) error {
+		keys = append(keys, string(entry.Key))
+		offsets = append(offsets, offset)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"single", "b1", string(batchCommitKey)}, keys, "Expected batch entries and commit record as written")
+	assert.Equal(t, []int64{0, single.Size(), single.Size() + b1.Size()}, offsets)
+
+	err = LoadEntries(all[:len(all)-1], func(entry *Entry, offset int64) error { return nil })
+	assert.Error(t, err, "Expected an error on truncated entry")
+}
+
+func Test_CheckTail(t *testing.T) {
+	defer os.Remove(batchFilePath)
+
+	e1, _ := NewEntry([]byte("k1"), []byte("v1"))
+	e1Bytes, _ := e1.Dump()
+	e2, _ := NewEntry([]byte("k2"), []byte("v2"))
+	e2Bytes, _ := e2.Dump()
+	b1, _ := NewEntry([]byte("b1"), []byte("v1"))
+	batchBytes, _ := DumpBatch([]*Entry{b1})
+	uncommitted := batchBytes[:b1.Size()]
+
+	check := func(contents ...[]byte) (int64, error) {
+		f, _ := os.OpenFile(batchFilePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+		defer f.Close()
+		for _, b := range contents {
+			f.Write(b)
+		}
+		end, _ := ReadEntries(f, func(entry *Entry, pos int64) error { return nil })
+		return end, CheckTail(f, end)
+	}
+
+	end, err := check(e1Bytes, e2Bytes)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(e1Bytes)+len(e2Bytes)), end)
+	_, err = check(e1Bytes, e2Bytes[:len(e2Bytes)-1])
+	assert.Nil(t, err, "Expected a short final entry to be an interrupted write")
+	_, err = check(e1Bytes, uncommitted, batchBytes[b1.Size():len(batchBytes)-3])
+	assert.Nil(t, err, "Expected a batch with a short commit record to be an interrupted write")
+	_, err = check(e1Bytes, uncommitted)
+	assert.Nil(t, err, "Expected a batch missing its commit record to be an interrupted write")
+
+	_, err = check(e1Bytes, make([]byte, 300))
+	assert.Nil(t, err, "Expected zeros at the end to be an interrupted write")
+
+	corrupted := append([]byte(nil), e1Bytes...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	end, err = check(corrupted, e2Bytes)
+	assert.Equal(t, int64(0), end)
+	assert.EqualError(t, err, "Broken entry at offset 0")
+	_, err = check(e1Bytes, corrupted)
+	assert.EqualError(t, err, fmt.Sprintf("Broken entry at offset %d", len(e1Bytes)), "Expected a broken final entry to be corruption")
+}
@@ -0,0 +1,223 @@
+package data
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Codec compresses values stored in data files. Each codec has its
+// own entry flag, so that entries tell how their value is compressed.
+type Codec interface {
+	Name() string
+	Flag() uint8
+	NewWriter(w io.Writer) io.WriteCloser
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Supported codecs
+var (
+	Flate Codec = flateCodec{}
+	Gzip  Codec = gzipCodec{}
+)
+
+// Registered codecs, by name and by flag
+var (
+	codecsMu     sync.RWMutex
+	codecsByName = make(map[string]Codec)
+	codecsByFlag = make(map[uint8]Codec)
+)
+
+func init() {
+	RegisterCodec(Flate)
+	RegisterCodec(Gzip)
+}
+
+// RegisterCodec makes c available to CodecByName and to the decoding
+// of values flagged with its flag. Names are case insensitive. The flag
+// is what data files record, it has to be a single bit not used by
+// other entry flags and must not change once values are written with
+// it. It panics if c doesn't meet those or clashes with a codec
+// registered before, and is meant to be called from init functions.
+func RegisterCodec(c Codec) {
+	name, flag := strings.ToLower(c.Name()), c.Flag()
+	if name == "" || name == "none" {
+		panic(fmt.Sprintf("Invalid codec name: %q", c.Name()))
+	}
+	if flag == 0 || flag&(flag-1) != 0 || flag&reservedFlags != 0 {
+		panic(fmt.Sprintf("Invalid flag of codec %s: %#x", name, flag))
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, ok := codecsByName[name]; ok {
+		panic("Codec registered twice: " + name)
+	}
+	if other, ok := codecsByFlag[flag]; ok {
+		panic(fmt.Sprintf("Flag of codec %s already used by %s", name, other.Name()))
+	}
+	codecsByName[name] = c
+	codecsByFlag[flag] = c
+}
+
+type flateCodec struct{}
+
+func (flateCodec) Name() string { return "flate" }
+func (flateCodec) Flag() uint8  { return FlagFlate }
+
+func (flateCodec) NewWriter(w io.Writer) io.WriteCloser {
+	// only fails on an invalid level
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	return fw
+}
+
+func (flateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+func (gzipCodec) Flag() uint8  { return FlagGzip }
+
+func (gzipCodec) NewWriter(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// CodecByName returns the codec registered as name, nil when name is
+// empty or "none"
+func CodecByName(name string) (Codec, error) {
+	name = strings.ToLower(name)
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c, ok := codecsByName[name]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("Unknown compression: %s", name)
+}
+
+// codecByFlags returns the codec a value with given entry flags is
+// compressed with, nil if it isn't compressed
+func codecByFlags(flags uint8) (Codec, error) {
+	flag := flags & compressionFlags
+	if flag == 0 {
+		return nil, nil
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c, ok := codecsByFlag[flag]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("Unknown compression flag: %#x", flag)
+}
+
+// NewDecoder returns a reader of the value of entry as it was written,
+// given a reader of the value as stored. Only the header fields of
+// entry are used, k may be nil if no value is encrypted.
+func NewDecoder(k *Keyring, entry *Entry, r io.Reader) (io.ReadCloser, error) {
+	codec, err := codecByFlags(entry.Flags)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Flags&FlagEncrypted != 0 {
+		dr, err := k.newReader(r, entry)
+		if err != nil {
+			return nil, err
+		}
+		r = dr
+	}
+	if codec == nil {
+		return ioutil.NopCloser(r), nil
+	}
+	return codec.NewReader(r)
+}
+
+// Compress replaces the value of entry with its compressed form,
+// unless that isn't smaller. RawSize keeps the original size. It has
+// to be done before encryption.
+func (entry *Entry) Compress(codec Codec) error {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	if _, err := w.Write(entry.Value); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if buf.Len() >= len(entry.Value) {
+		return nil
+	}
+	entry.Flags |= codec.Flag()
+	entry.RawSize = entry.ValueSize
+	entry.Value = buf.Bytes()
+	entry.ValueSize = uint32(buf.Len())
+	return nil
+}
+
+// IsCompressed tells if the value of entry is stored compressed
+func (entry *Entry) IsCompressed() bool {
+	return entry.Flags&compressionFlags != 0
+}
+
+// IsEncoded tells if the value of entry is stored compressed or
+// encrypted, rather than as it was written
+func (entry *Entry) IsEncoded() bool {
+	return entry.Flags&encodingFlags != 0
+}
+
+// DecodedValue returns the value of entry as it was written, k may be
+// nil if no value is encrypted
+func (entry *Entry) DecodedValue(k *Keyring) ([]byte, error) {
+	if !entry.IsEncoded() {
+		return entry.Value, nil
+	}
+	r, err := NewDecoder(k, entry, bytes.NewReader(entry.Value))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	value, err := ioutil.ReadAll(r)
+	if err == ErrDecrypt {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decompress value: %s", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,152 @@
+package data
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Compress(t *testing.T) {
+	value := bytes.Repeat([]byte("compressible "), 100)
+	for _, codec := range []Codec{Flate, Gzip} {
+		entry, _ := NewEntry(fakeKey, value)
+		err := entry.Compress(codec)
+		assert.Nil(t, err, "Expected no error on compression")
+		assert.True(t, entry.IsCompressed(), fmt.Sprintf("Expected %s to shrink the value", codec.Name()))
+		assert.Equal(t, uint32(len(value)), entry.RawSize)
+		assert.Less(t, entry.ValueSize, entry.RawSize)
+
+		entryBytes, _ := entry.Dump()
+		loaded, err := LoadFromBytes(entryBytes)
+		assert.Nil(t, err, "Expected no error on loading compressed entry")
+		decoded, err := loaded.DecodedValue(nil)
+		assert.Nil(t, err, "Expected no error on decompression")
+		assert.Equal(t, value, decoded)
+
+		r, _ := NewDecoder(nil, loaded, bytes.NewReader(loaded.Value))
+		streamed, _ := ioutil.ReadAll(r)
+		assert.Equal(t, value, streamed, "Expected streamed value to match")
+	}
+
+	entry, _ := NewEntry(fakeKey, fakeValue)
+	entry.Compress(Gzip)
+	assert.False(t, entry.IsCompressed(), "Expected value to be kept when compression doesn't help")
+	assert.Equal(t, fakeValue, entry.Value)
+}
+
+func Test_CodecByName(t *testing.T) {
+	codec, err := CodecByName("")
+	assert.Nil(t, err)
+	assert.Nil(t, codec, "Expected no codec by default")
+
+	codec, _ = CodecByName("GZIP")
+	assert.Equal(t, Gzip, codec)
+
+	_, err = CodecByName("zstd")
+	assert.Error(t, err, "Expected an error on unknown codec")
+}
+
+// reverseCodec stores values reversed, which doesn't make them smaller
+// but is easy to check
+type reverseCodec struct {
+	name string
+	flag uint8
+}
+
+func (c reverseCodec) Name() string { return c.name }
+func (c reverseCodec) Flag() uint8  { return c.flag }
+
+func (c reverseCodec) NewWriter(w io.Writer) io.WriteCloser {
+	return &reverseWriter{w: w}
+}
+
+func (c reverseCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(reverse(b))), nil
+}
+
+type reverseWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (w *reverseWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *reverseWriter) Close() error {
+	// one byte shorter, so that Compress keeps it
+	_, err := w.w.Write(reverse(w.buf.Bytes())[1:])
+	return err
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+func Test_RegisterCodec(t *testing.T) {
+	custom := reverseCodec{"Reverse", 1 << 7}
+	RegisterCodec(custom)
+	defer func() {
+		codecsMu.Lock()
+		delete(codecsByName, "reverse")
+		delete(codecsByFlag, custom.flag)
+		codecsMu.Unlock()
+	}()
+
+	codec, err := CodecByName("reverse")
+	assert.Nil(t, err)
+	assert.Equal(t, custom, codec)
+
+	entry, _ := NewEntry(fakeKey, []byte("abcdef"))
+	assert.Nil(t, entry.Compress(codec))
+	assert.True(t, entry.IsCompressed())
+	assert.Equal(t, []byte("edcba"), entry.Value)
+	decoded, err := entry.DecodedValue(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("abcde"), decoded, "Expected the value to be decoded by the registered codec")
+
+	assert.Panics(t, func() { RegisterCodec(reverseCodec{"reverse", 1 << 6}) }, "Expected names to be unique")
+	assert.Panics(t, func() { RegisterCodec(reverseCodec{"other", 1 << 7}) }, "Expected flags to be unique")
+	assert.Panics(t, func() { RegisterCodec(reverseCodec{"other", FlagGzip}) }, "Expected flags to be unique")
+	assert.Panics(t, func() { RegisterCodec(reverseCodec{"other", FlagEncrypted}) }, "Expected reserved flags to be rejected")
+	assert.Panics(t, func() { RegisterCodec(reverseCodec{"other", 3 << 5}) }, "Expected flags to be a single bit")
+	assert.Panics(t, func() { RegisterCodec(reverseCodec{"none", 1 << 6}) }, "Expected none to be reserved")
+
+	entry.Flags = 1 << 6
+	_, err = entry.DecodedValue(nil)
+	assert.EqualError(t, err, "Unknown compression flag: 0x40", "Expected values of unregistered codecs not to be returned as stored")
+}
@@ -0,0 +1,336 @@
+package data
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Encrypted values are sealed with AES-GCM in segments of
+// segmentSize bytes, so that large values can be streamed. The value
+// is a random nonce followed by the sealed segments. The nonce of a
+// segment is that nonce xor its index, and the entry key, the index
+// and whether it's the last segment are authenticated with it.
+const (
+	segmentSize = 64 * 1024
+	nonceSize   = 12
+)
+
+// ErrDecrypt is returned when an encrypted value can't be
+// authenticated, because of a wrong key or corrupted data
+var ErrDecrypt = errors.New("Failed to decrypt value: wrong key or corrupted data")
+
+// Keyring holds the key new values are encrypted with and older keys
+// existing values may still be encrypted with
+type Keyring struct {
+	primary *encryptionKey
+	keys    map[uint32]*encryptionKey
+}
+
+type encryptionKey struct {
+	id   uint32
+	aead cipher.AEAD
+}
+
+// NewKeyring creates a keyring from 32 bytes AES keys, new values
+// are encrypted with primary
+func NewKeyring(primary []byte, old ...[]byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[uint32]*encryptionKey)}
+	for i, raw := range append([][]byte{primary}, old...) {
+		key, err := newEncryptionKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.keys[key.id]; ok {
+			return nil, fmt.Errorf("Duplicate encryption key %08x", key.id)
+		}
+		k.keys[key.id] = key
+		if i == 0 {
+			k.primary = key
+		}
+	}
+	return k, nil
+}
+
+// LoadKeyring reads the keys of a keyring from files, each one holds
+// a 32 bytes key in hex. It returns nil when primary is empty.
+func LoadKeyring(primary string, old []string) (*Keyring, error) {
+	if primary == "" {
+		if len(old) > 0 {
+			return nil, errors.New("Old encryption keys need a current one")
+		}
+		return nil, nil
+	}
+	var keys [][]byte
+	for _, path := range append([]string{primary}, old...) {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read encryption key: %s", err)
+		}
+		key, err := hex.DecodeString(string(bytes.TrimSpace(content)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("Encryption key must be 32 bytes in hex: %s", path)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeyring(keys[0], keys[1:]...)
+}
+
+func newEncryptionKey(raw []byte) (*encryptionKey, error) {
+	if len(raw) != 32 {
+		return nil, errors.New("Encryption key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &encryptionKey{id: binary.BigEndian.Uint32(sum[:4]), aead: aead}, nil
+}
+
+// PrimaryID returns the id of the key new values are encrypted with
+func (k *Keyring) PrimaryID() uint32 {
+	return k.primary.id
+}
+
+// HasKey tells if the key of id is in the keyring
+func (k *Keyring) HasKey(id uint32) bool {
+	_, ok := k.keys[id]
+	return ok
+}
+
+// Encrypt replaces the value of entry with its encrypted form
+func (k *Keyring) Encrypt(entry *Entry) error {
+	var buf bytes.Buffer
+	w, err := k.NewWriter(&buf, entry.Key)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(entry.Value); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if !entry.IsEncoded() {
+		entry.RawSize = entry.ValueSize
+	}
+	entry.Flags |= FlagEncrypted
+	entry.KeyID = k.primary.id
+	entry.Value = buf.Bytes()
+	entry.ValueSize = uint32(buf.Len())
+	return nil
+}
+
+// Rotate makes sure the value of entry is encrypted with the primary
+// key. Values encrypted with another key are decrypted first, and
+// compression is kept as it is.
+func (k *Keyring) Rotate(entry *Entry) error {
+	if entry.Flags&FlagEncrypted != 0 {
+		if entry.KeyID == k.primary.id {
+			return nil
+		}
+		r, err := k.newReader(bytes.NewReader(entry.Value), entry)
+		if err != nil {
+			return err
+		}
+		value, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		entry.Flags &^= FlagEncrypted
+		entry.KeyID = 0
+		entry.Value = value
+		entry.ValueSize = uint32(len(value))
+	}
+	return k.Encrypt(entry)
+}
+
+// NewWriter returns a writer encrypting a value of key with the
+// primary key, the value is complete once it's closed
+func (k *Keyring) NewWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(nonce); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:     w,
+		aead:  k.primary.aead,
+		nonce: nonce,
+		key:   key,
+		buf:   make([]byte, 0, segmentSize),
+	}, nil
+}
+
+// newReader returns a reader decrypting the value of entry read
+// from r
+func (k *Keyring) newReader(r io.Reader, entry *Entry) (io.Reader, error) {
+	if k == nil {
+		return nil, errors.New("Value is encrypted but no encryption key is configured")
+	}
+	key, ok := k.keys[entry.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("Value is encrypted with key %08x, which isn't configured", entry.KeyID)
+	}
+	br := bufio.NewReaderSize(r, segmentSize+key.aead.Overhead()+1)
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return nil, ErrDecrypt
+	}
+	return &decryptReader{
+		r:     br,
+		aead:  key.aead,
+		nonce: nonce,
+		key:   entry.Key,
+	}, nil
+}
+
+// segmentNonce returns the nonce of segment i
+func segmentNonce(nonce []byte, i uint32) []byte {
+	n := append([]byte(nil), nonce...)
+	last := binary.BigEndian.Uint32(n[nonceSize-4:])
+	binary.BigEndian.PutUint32(n[nonceSize-4:], last^i)
+	return n
+}
+
+// segmentData returns the additional data authenticated with segment i
+func segmentData(key []byte, i uint32, last bool) []byte {
+	ad := make([]byte, len(key)+5)
+	copy(ad, key)
+	binary.BigEndian.PutUint32(ad[len(key):], i)
+	if last {
+		ad[len(ad)-1] = 1
+	}
+	return ad
+}
+
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	key   []byte
+	buf   []byte
+	index uint32
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// a full segment is only sealed once more data shows it
+		// isn't the last one
+		if len(e.buf) == segmentSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):segmentSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	sealed := e.aead.Seal(nil, segmentNonce(e.nonce, e.index), e.buf, segmentData(e.key, e.index, last))
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.buf = e.buf[:0]
+	e.index++
+	return nil
+}
+
+type decryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	key   []byte
+	index uint32
+	plain []byte // decrypted bytes not read yet
+	done  bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open decrypts the next segment, it's the last one if nothing
+// follows it
+func (d *decryptReader) open() error {
+	sealed := make([]byte, segmentSize+d.aead.Overhead())
+	n, err := io.ReadFull(d.r, sealed)
+	last := err == io.ErrUnexpectedEOF || err == io.EOF
+	if err != nil && !last {
+		return err
+	}
+	if !last {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := d.aead.Open(nil, segmentNonce(d.nonce, d.index), sealed[:n], segmentData(d.key, d.index, last))
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.plain = plain
+	d.index++
+	d.done = last
+	return nil
+}
@@ -0,0 +1,123 @@
+package data
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testKey1    = bytes.Repeat([]byte{1}, 32)
+	testKey2    = bytes.Repeat([]byte{2}, 32)
+	keyFilePath = "/tmp/bitcask_crypt_test.key"
+)
+
+func Test_EncryptDecrypt(t *testing.T) {
+	k, err := NewKeyring(testKey1)
+	assert.Nil(t, err, "Expected no error on keyring creation")
+
+	for _, size := range []int{1, segmentSize, 2 * segmentSize, 3*segmentSize + 7} {
+		value := bytes.Repeat([]byte("v"), size)
+		entry, _ := NewEntry(fakeKey, value)
+		err := k.Encrypt(entry)
+		assert.Nil(t, err, "Expected no error on encryption")
+		assert.Equal(t, uint32(size), entry.RawSize)
+		assert.Equal(t, k.PrimaryID(), entry.KeyID)
+
+		entryBytes, _ := entry.Dump()
+		loaded, _ := LoadFromBytes(entryBytes)
+		decoded, err := loaded.DecodedValue(k)
+		assert.Nil(t, err, fmt.Sprintf("Expected no error on decryption of %d bytes", size))
+		assert.Equal(t, value, decoded)
+
+		// dropping the last segment must not go unnoticed
+		if size > segmentSize {
+			loaded.Value = loaded.Value[:nonceSize+segmentSize+16]
+			_, err = loaded.DecodedValue(k)
+			assert.Equal(t, ErrDecrypt, err, "Expected an error on truncated value")
+		}
+	}
+}
+
+func Test_WrongKey(t *testing.T) {
+	k1, _ := NewKeyring(testKey1)
+	k2, _ := NewKeyring(testKey2)
+	entry, _ := NewEntry(fakeKey, fakeValue)
+	k1.Encrypt(entry)
+
+	_, err := entry.DecodedValue(k2)
+	assert.EqualError(t, err, fmt.Sprintf("Value is encrypted with key %08x, which isn't configured", k1.PrimaryID()))
+	_, err = entry.DecodedValue(nil)
+	assert.Error(t, err, "Expected an error without keyring")
+
+	// same key id, tampered value
+	entry.Value[len(entry.Value)-1] ^= 1
+	_, err = entry.DecodedValue(k1)
+	assert.Equal(t, ErrDecrypt, err)
+}
+
+func Test_Rotate(t *testing.T) {
+	k1, _ := NewKeyring(testKey1)
+	entry, _ := NewEntry(fakeKey, bytes.Repeat(fakeValue, 100))
+	entry.Compress(Gzip)
+	k1.Encrypt(entry)
+
+	k2, _ := NewKeyring(testKey2, testKey1)
+	err := k2.Rotate(entry)
+	assert.Nil(t, err, "Expected no error on rotation")
+	assert.Equal(t, k2.PrimaryID(), entry.KeyID)
+	assert.True(t, entry.IsCompressed(), "Expected compression to be kept")
+	decoded, err := entry.DecodedValue(k2)
+	assert.Nil(t, err)
+	assert.Equal(t, bytes.Repeat(fakeValue, 100), decoded)
+
+	plain, _ := NewEntry(fakeKey, fakeValue)
+	k2.Rotate(plain)
+	assert.Equal(t, k2.PrimaryID(), plain.KeyID, "Expected plain values to get encrypted")
+}
+
+func Test_LoadKeyring(t *testing.T) {
+	defer os.Remove(keyFilePath)
+
+	k, err := LoadKeyring("", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, k, "Expected no keyring without key file")
+
+	ioutil.WriteFile(keyFilePath, []byte(hex.EncodeToString(testKey1)+"\n"), 0600)
+	k, err = LoadKeyring(keyFilePath, nil)
+	assert.Nil(t, err, "Expected no error on valid key file")
+	assert.True(t, k.HasKey(k.PrimaryID()))
+
+	ioutil.WriteFile(keyFilePath, []byte("short"), 0600)
+	_, err = LoadKeyring(keyFilePath, nil)
+	assert.Error(t, err, "Expected an error on invalid key")
+}
@@ -30,16 +30,60 @@ import (
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"os"
 
 	"github.com/Panda-Home/bitcask/utils"
 )
 
+// HeaderSize is the size of an entry header in bytes
+const HeaderSize = 160
+
+// Fields added after the original header live in the unused bytes of
+// the timestamp slot, which are zero in entries written before.
+const (
+	flagsOffset   = 40
+	versionOffset = 48
+	rawSizeOffset = 56
+	keyIDOffset   = 60
+)
+
+// ErrChecksumMismatch is returned when a value read from a data file
+// doesn't match the checksum of its entry
+var ErrChecksumMismatch = errors.New("Checksum mismatch")
+
+// Entry flags
+const (
+	// FlagBatch marks an entry written as part of a batch, it only
+	// counts once the commit record of its batch is read.
+	FlagBatch uint8 = 1 << iota
+	// FlagBatchCommit marks the record closing a batch
+	FlagBatchCommit
+	// FlagFlate marks a value compressed with Flate
+	FlagFlate
+	// FlagGzip marks a value compressed with Gzip
+	FlagGzip
+	// FlagEncrypted marks a value encrypted with the key of KeyID
+	FlagEncrypted
+)
+
+const (
+	// reservedFlags can't be given to a codec, any other flag marks a
+	// compressed value
+	reservedFlags    = FlagBatch | FlagBatchCommit | FlagEncrypted
+	compressionFlags = ^reservedFlags
+	encodingFlags    = compressionFlags | FlagEncrypted
+)
+
 // Entry ...
 type Entry struct {
 	// header
 	Checksum  uint32
 	Timestamp uint64
+	Flags     uint8
+	Version   uint64 // 0 for entries written before versions existed
+	RawSize   uint32 // size of the value before compression or encryption, if any
+	KeyID     uint32 // id of the encryption key, if the value is encrypted
 	KeySize   uint32
 	ValueSize uint32
 	// body
@@ -65,6 +109,10 @@ func NewEntry(key, value []byte) (*Entry, error) {
 func (entry *Entry) Dump() ([]byte, error) {
 	entryBytes := make([]byte, 32+64+32+32+entry.KeySize+entry.ValueSize)
 	binary.BigEndian.PutUint64(entryBytes[32:], entry.Timestamp)
+	entryBytes[flagsOffset] = entry.Flags
+	binary.BigEndian.PutUint64(entryBytes[versionOffset:], entry.Version)
+	binary.BigEndian.PutUint32(entryBytes[rawSizeOffset:], entry.RawSize)
+	binary.BigEndian.PutUint32(entryBytes[keyIDOffset:], entry.KeyID)
 	binary.BigEndian.PutUint32(entryBytes[96:], entry.KeySize)
 	binary.BigEndian.PutUint32(entryBytes[128:], entry.ValueSize)
 	copy(entryBytes[160:], entry.Key)
@@ -74,6 +122,34 @@ func (entry *Entry) Dump() ([]byte, error) {
 	return entryBytes, nil
 }
 
+// DumpHeader serializes the header and key of entry. The checksum is
+// computed from the ValueSize bytes read from value, so that a large
+// value can be written after the header without being held in memory.
+func (entry *Entry) DumpHeader(value io.Reader) ([]byte, error) {
+	headerBytes := make([]byte, HeaderSize+entry.KeySize)
+	binary.BigEndian.PutUint64(headerBytes[32:], entry.Timestamp)
+	headerBytes[flagsOffset] = entry.Flags
+	binary.BigEndian.PutUint64(headerBytes[versionOffset:], entry.Version)
+	binary.BigEndian.PutUint32(headerBytes[rawSizeOffset:], entry.RawSize)
+	binary.BigEndian.PutUint32(headerBytes[keyIDOffset:], entry.KeyID)
+	binary.BigEndian.PutUint32(headerBytes[96:], entry.KeySize)
+	binary.BigEndian.PutUint32(headerBytes[128:], entry.ValueSize)
+	copy(headerBytes[160:], entry.Key)
+
+	h := crc32.NewIEEE()
+	h.Write(headerBytes[32:])
+	n, err := io.Copy(h, io.LimitReader(value, int64(entry.ValueSize)))
+	if err != nil {
+		return nil, err
+	}
+	if n != int64(entry.ValueSize) {
+		return nil, fmt.Errorf("Value is %d bytes, expected %d", n, entry.ValueSize)
+	}
+	entry.Checksum = h.Sum32()
+	binary.BigEndian.PutUint32(headerBytes, entry.Checksum)
+	return headerBytes, nil
+}
+
 // LoadFromBytes converts byte array to Entry struct
 func LoadFromBytes(entryBytes []byte) (*Entry, error) {
 	if !ValidateEntry(entryBytes) {
@@ -85,6 +161,10 @@ func LoadFromBytes(entryBytes []byte) (*Entry, error) {
 	return &Entry{
 		Checksum:  binary.BigEndian.Uint32(entryBytes[:32]),
 		Timestamp: binary.BigEndian.Uint64(entryBytes[32:96]),
+		Flags:     entryBytes[flagsOffset],
+		Version:   binary.BigEndian.Uint64(entryBytes[versionOffset:]),
+		RawSize:   binary.BigEndian.Uint32(entryBytes[rawSizeOffset:]),
+		KeyID:     binary.BigEndian.Uint32(entryBytes[keyIDOffset:]),
 		KeySize:   keySize,
 		ValueSize: valueSize,
 		Key:       entryBytes[160 : 160+keySize],
@@ -132,6 +212,10 @@ func LoadFromFile(f *os.File, pos int64) (*Entry, error) {
 	return &Entry{
 		Checksum:  binary.BigEndian.Uint32(crc),
 		Timestamp: binary.BigEndian.Uint64(ts),
+		Flags:     ts[flagsOffset-32],
+		Version:   binary.BigEndian.Uint64(ts[versionOffset-32:]),
+		RawSize:   binary.BigEndian.Uint32(ts[rawSizeOffset-32:]),
+		KeyID:     binary.BigEndian.Uint32(ts[keyIDOffset-32:]),
 		KeySize:   ksInt,
 		ValueSize: vsInt,
 		Key:       key,
@@ -139,6 +223,88 @@ func LoadFromFile(f *os.File, pos int64) (*Entry, error) {
 	}, nil
 }
 
+// ValueReader streams the value of an entry from a data file. The
+// checksum is computed as the value is read, and ErrChecksumMismatch
+// is returned instead of io.EOF when it doesn't match.
+type ValueReader struct {
+	header   *Entry
+	value    io.Reader
+	crc      uint32
+	checksum uint32
+}
+
+// NewValueReader reads the header and key of the entry at pos and
+// returns a reader over its value
+func NewValueReader(f *os.File, pos int64) (*ValueReader, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := f.ReadAt(header, pos); err != nil {
+		return nil, err
+	}
+	keySize := binary.BigEndian.Uint32(header[96:128])
+	valueSize := binary.BigEndian.Uint32(header[128:160])
+	key := make([]byte, keySize)
+	if _, err := f.ReadAt(key, pos+HeaderSize); err != nil {
+		return nil, err
+	}
+	crc := crc32.ChecksumIEEE(header[32:])
+	return &ValueReader{
+		header: &Entry{
+			Checksum:  binary.BigEndian.Uint32(header[:32]),
+			Timestamp: binary.BigEndian.Uint64(header[32:96]),
+			Flags:     header[flagsOffset],
+			Version:   binary.BigEndian.Uint64(header[versionOffset:]),
+			RawSize:   binary.BigEndian.Uint32(header[rawSizeOffset:]),
+			KeyID:     binary.BigEndian.Uint32(header[keyIDOffset:]),
+			KeySize:   keySize,
+			ValueSize: valueSize,
+			Key:       key,
+		},
+		value:    io.NewSectionReader(f, pos+HeaderSize+int64(keySize), int64(valueSize)),
+		crc:      crc32.Update(crc, crc32.IEEETable, key),
+		checksum: binary.BigEndian.Uint32(header[:32]),
+	}, nil
+}
+
+// Size returns the size of the value in bytes
+func (r *ValueReader) Size() uint32 {
+	return r.header.ValueSize
+}
+
+// Header returns the entry being read, without its value
+func (r *ValueReader) Header() *Entry {
+	return r.header
+}
+
+func (r *ValueReader) Read(p []byte) (int, error) {
+	n, err := r.value.Read(p)
+	r.crc = crc32.Update(r.crc, crc32.IEEETable, p[:n])
+	if err == io.EOF && r.crc != r.checksum {
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
+
+// ReadValueRange reads length bytes of the value of the entry at pos,
+// starting offset bytes into the value. Only these bytes are read, so
+// unlike LoadFromFile the checksum isn't verified.
+func ReadValueRange(f *os.File, pos int64, keySize uint32, offset int64, length int) ([]byte, error) {
+	buf := make([]byte, length)
+	if _, err := f.ReadAt(buf, pos+HeaderSize+int64(keySize)+offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Size returns the number of bytes the entry takes in a data file
+func (entry *Entry) Size() int64 {
+	return int64(HeaderSize) + int64(entry.KeySize) + int64(entry.ValueSize)
+}
+
+// IsTombstone tells if the entry records a deleted key
+func (entry *Entry) IsTombstone() bool {
+	return entry.ValueSize == 0
+}
+
 // ValidateEntry validates if an entry byte array is correct
 func ValidateEntry(entryBytes []byte) bool {
 	// byte array should be longer than smallest struct size(160)
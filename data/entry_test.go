@@ -25,7 +25,9 @@ package data
 // SOFTWARE.
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -65,6 +67,7 @@ func Test_Dump(t *testing.T) {
 
 func Test_LoadFromBytes(t *testing.T) {
 	entry, _ := NewEntry(fakeKey, fakeValue)
+	entry.Version = 42
 	bytes, _ := entry.Dump()
 	brokenBytes := bytes[20:]
 	_, err := LoadFromBytes(brokenBytes)
@@ -74,6 +77,7 @@ func Test_LoadFromBytes(t *testing.T) {
 	assert.Nil(t, err, "Expected no error")
 	assert.Equal(t, entry.Checksum, entry2.Checksum, fmt.Sprintf("Expected checksum: %v, got: %v", entry.Checksum, entry2.Checksum))
 	assert.Equal(t, entry.Timestamp, entry2.Timestamp, fmt.Sprintf("Expected timestamp: %d, got: %d", entry.Timestamp, entry2.Timestamp))
+	assert.Equal(t, entry.Version, entry2.Version, fmt.Sprintf("Expected version: %d, got: %d", entry.Version, entry2.Version))
 	assert.Equal(t, entry.KeySize, entry2.KeySize, fmt.Sprintf("Expected key size: %d, got: %d", entry.KeySize, entry2.KeySize))
 	assert.Equal(t, entry.ValueSize, entry2.ValueSize, fmt.Sprintf("Expected value size: %d, got: %d", entry.ValueSize, entry2.ValueSize))
 	assert.Equal(t, entry.Key, entry2.Key, fmt.Sprintf("Expected key: %s, got: %s", entry.Key, entry2.Key))
@@ -96,6 +100,51 @@ func Test_LoadFromFile(t *testing.T) {
 	assert.Error(t, err, "Expected error when reading beyond EOF")
 }
 
+func Test_ReadValueRange(t *testing.T) {
+	prepareFile()
+	defer cleanupFile()
+
+	f, _ := os.OpenFile(entryFilePath, os.O_RDONLY, 0644)
+	defer f.Close()
+	value, err := ReadValueRange(f, 0, uint32(len(fakeKey)), 1, 2)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, fakeValue[1:3], value, fmt.Sprintf("Expected value: %s, got: %s", fakeValue[1:3], value))
+
+	_, err = ReadValueRange(f, 0, uint32(len(fakeKey)), 2, 2)
+	assert.Error(t, err, "Expected error when reading beyond EOF")
+}
+
+func Test_DumpHeader(t *testing.T) {
+	entry, _ := NewEntry(fakeKey, fakeValue)
+	entryBytes, _ := entry.Dump()
+
+	header, err := entry.DumpHeader(bytes.NewReader(fakeValue))
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, entryBytes[:len(header)], header, "Expected header to match the dumped entry")
+
+	_, err = entry.DumpHeader(bytes.NewReader(fakeValue[:1]))
+	assert.Error(t, err, "Expected error on short value")
+}
+
+func Test_ValueReader(t *testing.T) {
+	prepareFile()
+	defer cleanupFile()
+
+	f, _ := os.OpenFile(entryFilePath, os.O_RDWR, 0644)
+	defer f.Close()
+	r, err := NewValueReader(f, 0)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, uint32(len(fakeValue)), r.Size())
+	value, err := ioutil.ReadAll(r)
+	assert.Nil(t, err, "Expected no error on valid entry")
+	assert.Equal(t, fakeValue, value, fmt.Sprintf("Expected value: %s, got: %s", fakeValue, value))
+
+	f.WriteAt([]byte("z"), HeaderSize+int64(len(fakeKey)))
+	r, _ = NewValueReader(f, 0)
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, ErrChecksumMismatch, err, "Expected checksum mismatch on broken value")
+}
+
 func Test_ValidateEntry(t *testing.T) {
 	entry, _ := NewEntry(fakeKey, fakeValue)
 	bytes, _ := entry.Dump()
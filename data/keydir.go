@@ -31,20 +31,52 @@ import (
 // KeyDir ...
 type KeyDir struct {
 	dataMap map[string]*KeyDirEntry
+	index   *skipList // keys of dataMap in lexicographic order
 }
 
 // KeyDirEntry ...
 type KeyDirEntry struct {
 	FileID    string
-	ValueSize uint32
+	ValueSize uint32 // size of the value as stored
 	ValuePos  int64
 	Timestamp uint64
+	Version   uint64
+	Flags     uint8
+	RawSize   uint32 // size of the value before compression or encryption
+}
+
+// NewKeyDirEntry creates the KeyDir entry of entry, stored in file
+// fileID at valuePos
+func NewKeyDirEntry(fileID string, valuePos int64, entry *Entry) *KeyDirEntry {
+	return &KeyDirEntry{
+		FileID:    fileID,
+		ValueSize: entry.ValueSize,
+		ValuePos:  valuePos,
+		Timestamp: entry.Timestamp,
+		Version:   entry.Version,
+		Flags:     entry.Flags,
+		RawSize:   entry.RawSize,
+	}
+}
+
+// IsEncoded tells if the value is stored compressed or encrypted
+func (e *KeyDirEntry) IsEncoded() bool {
+	return e.Flags&encodingFlags != 0
+}
+
+// ValueLen returns the size of the value as it was written
+func (e *KeyDirEntry) ValueLen() uint32 {
+	if e.IsEncoded() {
+		return e.RawSize
+	}
+	return e.ValueSize
 }
 
 // NewKeyDir ...
 func NewKeyDir() *KeyDir {
 	return &KeyDir{
 		dataMap: make(map[string]*KeyDirEntry),
+		index:   newSkipList(),
 	}
 }
 
@@ -54,26 +86,26 @@ func (dir *KeyDir) SetEntryFromByteArray(fileID string, valuePos int64, entryByt
 	if err != nil {
 		return fmt.Errorf("Failed to create entry from byte array: %s", err)
 	}
-	dir.dataMap[string(entry.Key)] = &KeyDirEntry{
-		FileID:    fileID,
-		ValueSize: entry.ValueSize,
-		ValuePos:  valuePos,
-		Timestamp: entry.Timestamp,
-	}
+	dir.set(string(entry.Key), NewKeyDirEntry(fileID, valuePos, entry))
 	return nil
 }
 
 // SetEntryFromKeyValue sets KeyDir entry given all fields
 func (dir *KeyDir) SetEntryFromKeyValue(key []byte, fileID string, valuePos int64, valueSize uint32, ts uint64) error {
-	dir.dataMap[string(key)] = &KeyDirEntry{
+	dir.set(string(key), &KeyDirEntry{
 		FileID:    fileID,
 		ValueSize: valueSize,
 		ValuePos:  valuePos,
 		Timestamp: ts,
-	}
+	})
 	return nil
 }
 
+// SetEntry sets KeyDir entry of key
+func (dir *KeyDir) SetEntry(key []byte, entry *KeyDirEntry) {
+	dir.set(string(key), entry)
+}
+
 // GetValue ...
 func (dir *KeyDir) GetValue(key []byte) (*KeyDirEntry, error) {
 	if entry, ok := dir.dataMap[string(key)]; ok {
@@ -86,6 +118,7 @@ func (dir *KeyDir) GetValue(key []byte) (*KeyDirEntry, error) {
 func (dir *KeyDir) DelKeydirEntry(key []byte) error {
 	if dir.HasKey(key) {
 		delete(dir.dataMap, string(key))
+		dir.index.remove(string(key))
 		return nil
 	}
 	return fmt.Errorf("Key not found: %s", key)
@@ -96,3 +129,23 @@ func (dir *KeyDir) HasKey(key []byte) bool {
 	_, ok := dir.dataMap[string(key)]
 	return ok
 }
+
+// Len returns the number of keys in KeyDir
+func (dir *KeyDir) Len() int {
+	return len(dir.dataMap)
+}
+
+// Ascend calls fn on each key not less than start in lexicographic
+// order, until fn returns false.
+func (dir *KeyDir) Ascend(start []byte, fn func(key []byte, entry *KeyDirEntry) bool) {
+	dir.index.ascend(string(start), func(key string) bool {
+		return fn([]byte(key), dir.dataMap[key])
+	})
+}
+
+func (dir *KeyDir) set(key string, entry *KeyDirEntry) {
+	if _, ok := dir.dataMap[key]; !ok {
+		dir.index.insert(key)
+	}
+	dir.dataMap[key] = entry
+}
@@ -0,0 +1,131 @@
+package data
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"math/rand"
+)
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
+
+type skipListNode struct {
+	key  string
+	next []*skipListNode
+}
+
+// skipList is an ordered set of keys. It's not safe for concurrent
+// use, callers must synchronize like they do for KeyDir.
+type skipList struct {
+	head   *skipListNode
+	level  int
+	length int
+	rand   *rand.Rand
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:  &skipListNode{next: make([]*skipListNode, skipListMaxLevel)},
+		level: 1,
+		rand:  rand.New(rand.NewSource(1)),
+	}
+}
+
+func (l *skipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && l.rand.Float64() < skipListP {
+		level++
+	}
+	return level
+}
+
+// findPrev fills prev with the last node on each level whose key is
+// less than key, and returns the first node not less than key.
+func (l *skipList) findPrev(key string, prev []*skipListNode) *skipListNode {
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		if prev != nil {
+			prev[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+// insert adds key to the list, it's a no-op if key is already there
+func (l *skipList) insert(key string) {
+	prev := make([]*skipListNode, skipListMaxLevel)
+	if x := l.findPrev(key, prev); x != nil && x.key == key {
+		return
+	}
+
+	level := l.randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			prev[i] = l.head
+		}
+		l.level = level
+	}
+	node := &skipListNode{key: key, next: make([]*skipListNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = prev[i].next[i]
+		prev[i].next[i] = node
+	}
+	l.length++
+}
+
+// remove deletes key from the list and tells if it was there
+func (l *skipList) remove(key string) bool {
+	prev := make([]*skipListNode, skipListMaxLevel)
+	x := l.findPrev(key, prev)
+	if x == nil || x.key != key {
+		return false
+	}
+	for i := 0; i < l.level; i++ {
+		if prev[i].next[i] != x {
+			break
+		}
+		prev[i].next[i] = x.next[i]
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.length--
+	return true
+}
+
+// ascend calls fn on each key not less than start in ascending
+// order until fn returns false.
+func (l *skipList) ascend(start string, fn func(key string) bool) {
+	for x := l.findPrev(start, nil); x != nil; x = x.next[0] {
+		if !fn(x.key) {
+			return
+		}
+	}
+}
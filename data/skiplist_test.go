@@ -0,0 +1,88 @@
+package data
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SkipListInsertRemove(t *testing.T) {
+	l := newSkipList()
+	keys := rand.Perm(1000)
+	for _, k := range keys {
+		l.insert(fmt.Sprintf("key-%04d", k))
+	}
+	l.insert("key-0001")
+	assert.Equal(t, 1000, l.length, "Expected duplicated insert to be ignored")
+
+	assert.True(t, l.remove("key-0500"), "Expected existing key to be removed")
+	assert.False(t, l.remove("key-0500"), "Expected false on removed key")
+	assert.False(t, l.remove("no-exist"), "Expected false on non-exist key")
+	assert.Equal(t, 999, l.length)
+
+	var got []string
+	l.ascend("", func(key string) bool {
+		got = append(got, key)
+		return true
+	})
+	assert.True(t, sort.StringsAreSorted(got), "Expected keys in ascending order")
+	assert.Equal(t, 999, len(got))
+}
+
+func Test_SkipListAscend(t *testing.T) {
+	l := newSkipList()
+	for _, k := range []string{"b", "d", "a", "c", "e"} {
+		l.insert(k)
+	}
+
+	var got []string
+	l.ascend("bb", func(key string) bool {
+		got = append(got, key)
+		return len(got) < 2
+	})
+	assert.Equal(t, []string{"c", "d"}, got, "Expected iteration from first key not less than start")
+}
+
+func Test_KeyDirAscend(t *testing.T) {
+	dir := NewKeyDir()
+	for _, k := range []string{"user:2", "user:1", "order:1", "user:3"} {
+		dir.SetEntryFromKeyValue([]byte(k), "fakeFileID", int64(0), uint32(3), uint64(0))
+	}
+	dir.DelKeydirEntry([]byte("user:2"))
+	assert.Equal(t, 3, dir.Len())
+
+	var got []string
+	dir.Ascend([]byte("user:"), func(key []byte, entry *KeyDirEntry) bool {
+		assert.Equal(t, "fakeFileID", entry.FileID)
+		got = append(got, string(key))
+		return true
+	})
+	assert.Equal(t, []string{"user:1", "user:3"}, got, "Expected deleted keys to be skipped")
+}
@@ -0,0 +1,292 @@
+// Package logging provides a leveled logger writing structured
+// records either as logfmt style text or as JSON lines.
+package logging
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log record
+type Level int
+
+// Supported levels, from the most verbose one
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel converts level name to Level, empty name means info
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("Unknown log level: %s", name)
+	}
+}
+
+// Logger writes records at or above its level to output
+type Logger struct {
+	level  Level
+	isJSON bool
+	out    io.Writer
+	closer io.Closer
+
+	mu sync.Mutex
+}
+
+// New creates a logger writing to out. Format is either "text" or "json",
+// empty format means text.
+func New(out io.Writer, level Level, format string) (*Logger, error) {
+	l := &Logger{
+		level: level,
+		out:   out,
+	}
+	switch strings.ToLower(format) {
+	case "", "text":
+	case "json":
+		l.isJSON = true
+	default:
+		return nil, fmt.Errorf("Unknown log format: %s", format)
+	}
+	return l, nil
+}
+
+// Open creates a logger from configuration values. Records go to
+// stderr when path is empty, otherwise they're appended to the file.
+func Open(level, format, path string) (*Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return New(os.Stderr, lvl, format)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create log directory: %s", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open log file: %s", err)
+	}
+	l, err := New(f, lvl, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.closer = f
+	return l, nil
+}
+
+// Close releases the log file if the logger owns one
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// Enabled tells if records at given level would be written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Debug logs msg with alternating key value pairs at debug level
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info logs msg with alternating key value pairs at info level
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warn logs msg with alternating key value pairs at warn level
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+// Error logs msg with alternating key value pairs at error level
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "(MISSING)")
+	}
+
+	var buf bytes.Buffer
+	ts := time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	if l.isJSON {
+		buf.WriteString(`{"time":`)
+		writeJSON(&buf, ts)
+		buf.WriteString(`,"level":`)
+		writeJSON(&buf, level.String())
+		buf.WriteString(`,"msg":`)
+		writeJSON(&buf, msg)
+		for i := 0; i < len(keyvals); i += 2 {
+			buf.WriteByte(',')
+			writeJSON(&buf, fmt.Sprint(keyvals[i]))
+			buf.WriteByte(':')
+			writeJSON(&buf, jsonValue(keyvals[i+1]))
+		}
+		buf.WriteString("}\n")
+	} else {
+		fmt.Fprintf(&buf, "time=%s level=%s msg=%s", ts, level, quote(msg))
+		for i := 0; i < len(keyvals); i += 2 {
+			fmt.Fprintf(&buf, " %s=%s", fmt.Sprint(keyvals[i]), quote(fmt.Sprint(keyvals[i+1])))
+		}
+		buf.WriteByte('\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+// jsonValue keeps numbers and booleans as they are, everything
+// else is rendered as its string form.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case time.Duration:
+		return v.String()
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		out.Reset()
+		enc.Encode(fmt.Sprint(v))
+	}
+	buf.Write(bytes.TrimRight(out.Bytes(), "\n"))
+}
+
+// quote wraps s in quotes when it can't be read back as a single value
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = &Logger{level: LevelInfo, out: os.Stderr}
+)
+
+// SetDefault replaces the logger used by the package level functions
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = l
+}
+
+// Default returns the logger used by the package level functions
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// Enabled tells if the default logger writes records at given level
+func Enabled(level Level) bool {
+	return Default().Enabled(level)
+}
+
+// Debug logs with the default logger at debug level
+func Debug(msg string, keyvals ...interface{}) {
+	Default().log(LevelDebug, msg, keyvals)
+}
+
+// Info logs with the default logger at info level
+func Info(msg string, keyvals ...interface{}) {
+	Default().log(LevelInfo, msg, keyvals)
+}
+
+// Warn logs with the default logger at warn level
+func Warn(msg string, keyvals ...interface{}) {
+	Default().log(LevelWarn, msg, keyvals)
+}
+
+// Error logs with the default logger at error level
+func Error(msg string, keyvals ...interface{}) {
+	Default().log(LevelError, msg, keyvals)
+}
+
+// Fatal logs with the default logger at error level and exits
+func Fatal(msg string, keyvals ...interface{}) {
+	Default().log(LevelError, msg, keyvals)
+	os.Exit(1)
+}
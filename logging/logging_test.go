@@ -0,0 +1,103 @@
+package logging
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var logFilePath = "/tmp/bitcask_logging_test/bitcask.log"
+
+func Test_ParseLevel(t *testing.T) {
+	level, err := ParseLevel("")
+	assert.Nil(t, err, "Expected no error on empty level")
+	assert.Equal(t, LevelInfo, level, "Expected info level by default")
+
+	level, err = ParseLevel("WARN")
+	assert.Nil(t, err, "Expected no error on upper case level")
+	assert.Equal(t, LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err, "Expected an error on unknown level")
+}
+
+func Test_TextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, LevelInfo, "text")
+	assert.Nil(t, err, "Expected no error on text logger creation")
+
+	l.Debug("hidden")
+	assert.Equal(t, 0, buf.Len(), "Expected debug record to be dropped at info level")
+
+	l.Info("Listening", "addr", "localhost:9876", "note", "two words")
+	line := buf.String()
+	assert.True(t, strings.HasPrefix(line, "time="), "Expected record to start with time")
+	assert.Contains(t, line, " level=info msg=Listening addr=localhost:9876 note=\"two words\"\n")
+
+	buf.Reset()
+	l.Error("odd", "key")
+	assert.Contains(t, buf.String(), "key=(MISSING)", "Expected placeholder on missing value")
+}
+
+func Test_JSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, LevelDebug, "json")
+	assert.Nil(t, err, "Expected no error on json logger creation")
+
+	l.Warn("Failed", "err", errors.New("boom"), "count", 3)
+	var record map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &record)
+	assert.Nil(t, err, "Expected a valid json record")
+	assert.Equal(t, "warn", record["level"])
+	assert.Equal(t, "Failed", record["msg"])
+	assert.Equal(t, "boom", record["err"])
+	assert.Equal(t, float64(3), record["count"])
+
+	_, err = New(&buf, LevelDebug, "xml")
+	assert.Error(t, err, "Expected an error on unknown format")
+}
+
+func Test_Open(t *testing.T) {
+	defer os.RemoveAll("/tmp/bitcask_logging_test")
+
+	l, err := Open("debug", "text", logFilePath)
+	assert.Nil(t, err, "Expected no error on opening log file")
+	l.Debug("to file")
+	l.Close()
+
+	content, _ := ioutil.ReadFile(logFilePath)
+	assert.Contains(t, string(content), "msg=\"to file\"")
+
+	_, err = Open("loud", "text", "")
+	assert.Error(t, err, "Expected an error on unknown level")
+}
@@ -25,49 +25,72 @@ package main
 // SOFTWARE.
 
 import (
+	"bufio"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/Panda-Home/bitcask/config"
+	"github.com/Panda-Home/bitcask/logging"
 	"github.com/Panda-Home/bitcask/merger"
 	"github.com/Panda-Home/bitcask/server"
+	"github.com/Panda-Home/bitcask/utils"
 )
 
-var configPath string
+var (
+	configPath   string
+	hashPassword bool
+)
 
 func init() {
 	flag.StringVar(&configPath, "c", "", "Path to config file")
+	flag.BoolVar(&hashPassword, "hash-password", false, "Read a password from stdin and print its hash for the users config")
 }
 
 func main() {
 	flag.Parse()
+	if hashPassword {
+		printPasswordHash()
+		return
+	}
 	if configPath == "" {
-		log.Fatal("Config file must be provided")
+		logging.Fatal("Config file must be provided")
 	}
 
 	c, err := config.NewBitcaskConfig(configPath)
 	if err != nil {
-		log.Fatalf("Failed to read config file: %s", err)
+		logging.Fatal("Failed to read config file", "err", err)
+	}
+
+	logger, err := logging.Open(c.LogLevel, c.LogFormat, c.LogFile)
+	if err != nil {
+		logging.Fatal("Failed to set up logging", "err", err)
 	}
+	logging.SetDefault(logger)
+	defer logger.Close()
 
 	if err := writePid(c.PidFile); err != nil {
-		log.Fatalf("Failed to write pidfile: %s", err)
+		logging.Fatal("Failed to write pidfile", "err", err)
 	}
 
 	s, err := server.NewServer(c)
 	if err != nil {
-		log.Fatalf("Failed to create server: %s", err)
+		logging.Fatal("Failed to create server", "err", err)
 	}
 
-	merger, err := merger.NewMerger(c, s)
-	if err != nil {
-		log.Fatalf("Failed to create merger: %s", err)
+	// Merging rewrites data files, which read-only servers never do
+	var m *merger.Merger
+	if !c.ReadOnly {
+		m, err = merger.NewMerger(c, s)
+		if err != nil {
+			logging.Fatal("Failed to create merger", "err", err)
+		}
 	}
 
 	done := make(chan interface{})
@@ -75,34 +98,45 @@ func main() {
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-signals
-		s.Stop()
-		merger.Stop()
+		logging.Info("Shutting down")
+		s.Shutdown()
+		if m != nil {
+			m.Stop()
+		}
+		if err := s.Close(); err != nil {
+			logging.Error("Failed to close data file", "err", err)
+		}
 		cleanup(c)
 		close(done)
 	}()
 	<-done
-	log.Println("Exit")
+	logging.Info("Exit")
 }
 
 func writePid(pidFile string) error {
 	if pidFile == "" {
-		log.Println("Pidfile is not configured. Use 'bitcask.pid' by default")
+		logging.Warn("Pidfile is not configured. Use 'bitcask.pid' by default")
 		pidFile = "bitcask.pid"
 	}
 
 	info, err := os.Stat(pidFile)
-	if os.IsExist(err) {
+	if err == nil {
 		if info.IsDir() {
 			return errors.New("Pidfile can't be a directory")
 		}
-		return errors.New("Bitcask is running")
+		// Left behind by a server which didn't stop cleanly unless
+		// its process is still there
+		if pid := utils.ReadPid(pidFile); utils.ProcessExists(pid) {
+			return fmt.Errorf("Bitcask is running with pid %d", pid)
+		}
+		logging.Warn("Removing stale pidfile", "pidfile", pidFile)
 	}
 
 	if err := os.MkdirAll(filepath.Dir(pidFile), 0755); err != nil {
 		return fmt.Errorf("Failed to create pidfile directory: %s", err)
 	}
 
-	f, err := os.OpenFile(pidFile, os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(pidFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("Failed to open pidfile: %s", err)
 	}
@@ -115,6 +149,22 @@ func writePid(pidFile string) error {
 	return nil
 }
 
+func printPasswordHash() {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		logging.Fatal("Failed to read password", "err", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		logging.Fatal("Password cannot be empty")
+	}
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		logging.Fatal("Failed to hash password", "err", err)
+	}
+	fmt.Println(hash)
+}
+
 func cleanup(c *config.BitcaskConfig) {
 	os.Remove(c.PidFile)
 }
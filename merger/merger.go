@@ -27,7 +27,6 @@ package merger
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -37,10 +36,15 @@ import (
 	"github.com/Panda-Home/bitcask/bitlog"
 	"github.com/Panda-Home/bitcask/config"
 	"github.com/Panda-Home/bitcask/data"
+	"github.com/Panda-Home/bitcask/logging"
+	"github.com/Panda-Home/bitcask/metrics"
 	"github.com/Panda-Home/bitcask/server"
 	"github.com/Panda-Home/bitcask/utils"
 )
 
+var mergeDuration = metrics.NewHistogram("bitcask_merge_duration_seconds", "Time spent merging data files.",
+	[]float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300})
+
 type Merger struct {
 	dirPath   string
 	fileSize  int
@@ -119,20 +123,24 @@ func (m *Merger) mergeOldFiles() error {
 	if oldDataFilesCount == 0 {
 		return nil
 	}
+	start := time.Now()
+	defer func() { mergeDuration.ObserveDuration(time.Since(start)) }()
 
 	logFile, err := bitlog.NewLogger(m.dirPath, m.fileSize, true)
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("Failed to open merged data file", "dir", m.dirPath, "err", err)
 	}
 	m.logFile = logFile
 
 	activeMergedFileTS, err := m.logFile.GetFileTS(m.logFile.ActiveFilepath())
 	if err != nil {
+		m.logFile.Close()
 		return fmt.Errorf("Failed to get timestamp from active merged file: %s", err)
 	}
 
 	// Read all data file's content
 	entries := make(map[string]*data.Entry)
+	var latest *data.Entry // highest version read
 	for _, f := range logFiles {
 		ts, _ := m.logFile.GetFileTS(f.Name())
 		if ts > activeMergedFileTS {
@@ -142,31 +150,35 @@ func (m *Merger) mergeOldFiles() error {
 		filePath := filepath.Join(m.dirPath, f.Name())
 		fileHandler, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
 		if err != nil {
-			log.Printf("Failed to open file: %s", filePath)
+			logging.Warn("Failed to open file", "file", filePath, "err", err)
 			continue
 		}
 
 		// Read each record from file to build KeyDir
-		var curPos int64 = 0
-		for {
-			entry, err := data.LoadFromFile(fileHandler, curPos)
-			if err != nil {
-				break
+		data.ReadEntries(fileHandler, func(entry *data.Entry, pos int64) error {
+			if latest == nil || entry.Version > latest.Version {
+				latest = entry
 			}
-			valueSize := entry.ValueSize
-			key := entry.Key
-			if valueSize == 0 {
-				delete(entries, string(key))
+			if entry.IsTombstone() {
+				delete(entries, string(entry.Key))
 			} else {
-				entries[string(key)] = entry // new value overrides old value automatically
+				entries[string(entry.Key)] = entry // new value overrides old value automatically
 			}
-			curPos += int64(160 + entry.KeySize + valueSize)
-		}
+			return nil
+		})
 		fileHandler.Close()
 	}
 
 	// Write merged file
+	keyring := m.server.Keyring()
 	for _, v := range entries {
+		// Values encrypted with an old key are encrypted again with
+		// the current one, so that old keys can be dropped
+		if keyring != nil {
+			if err := keyring.Rotate(v); err != nil {
+				logging.Warn("Failed to rotate encryption key", "key", v.Key, "err", err)
+			}
+		}
 		byteArray, err := v.Dump()
 		if err != nil {
 			// Skip broken entry
@@ -175,7 +187,23 @@ func (m *Merger) mergeOldFiles() error {
 		m.logFile.Write(byteArray)
 		fileID := m.logFile.ActiveFilepath()
 		pos := m.logFile.ActiveFilePos() - int64(len(byteArray))
-		m.server.UpdateKeyDir(v.Key, fileID, pos, v.ValueSize, v.Timestamp)
+		// Values are copied as stored, compressed ones stay compressed
+		m.server.UpdateKeyDir(v.Key, data.NewKeyDirEntry(fileID, pos, v))
+	}
+
+	// The server picks up its version from data files on start, the
+	// latest one mustn't go away along with a deleted key or versions
+	// would be given again. Values of older versions are live or
+	// deleted by a later write, so only a tombstone has to be kept.
+	if latest != nil && latest.IsTombstone() && latest.Version > 0 {
+		if byteArray, err := latest.Dump(); err == nil {
+			m.logFile.Write(byteArray)
+		}
+	}
+
+	// Merged values have to be on disk before their old copies go
+	if err := m.logFile.Close(); err != nil {
+		return fmt.Errorf("Failed to close merged data file: %s", err)
 	}
 
 	// Delete obsolete files
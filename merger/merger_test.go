@@ -0,0 +1,76 @@
+package merger
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/Panda-Home/bitcask/server"
+	"github.com/Panda-Home/bitcask/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T, dir string) *server.Server {
+	s, err := server.NewServer(&config.BitcaskConfig{Host: "127.0.0.1", DataDir: dir, DataSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func Test_MergeKeepsLatestVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcask-merger")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newTestServer(t, dir)
+	assert.Nil(t, s.Set([]byte("kept"), []byte("v")))
+	assert.Nil(t, s.Set([]byte("deleted"), []byte("v")))
+	assert.Nil(t, s.Del([]byte("deleted")))
+	version := s.Version()
+	s.Stop()
+
+	// a new active file, so that the one holding the writes is merged
+	ts := strconv.FormatUint(utils.MakeTimestampInMS()+1000, 10)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "data.bit."+ts), nil, 0644))
+	s = newTestServer(t, dir)
+	m := &Merger{dirPath: dir, fileSize: 1, server: s}
+	assert.Nil(t, m.mergeOldFiles())
+	s.Stop()
+
+	s = newTestServer(t, dir)
+	defer s.Stop()
+	assert.Equal(t, version, s.Version(), "Expected the version of the dropped delete to be kept")
+	_, err = s.Get([]byte("deleted"))
+	assert.Error(t, err)
+	value, err := s.Get([]byte("kept"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(value))
+}
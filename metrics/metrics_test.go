@@ -0,0 +1,106 @@
+package metrics
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Counter(t *testing.T) {
+	c := NewCounter("test_counter_total", "A test counter.")
+	c.Inc()
+	c.Add(2.5)
+	c.Add(-1)
+	assert.Equal(t, 3.5, c.Value(), "Expected negative values to be ignored")
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	assert.Equal(t, "# HELP test_counter_total A test counter.\n# TYPE test_counter_total counter\ntest_counter_total 3.5\n", buf.String())
+}
+
+func Test_CounterVec(t *testing.T) {
+	v := NewCounterVec("test_requests_total", "Requests.", "command")
+	v.With("set").Inc()
+	v.With("get").Add(2)
+	v.With("set").Inc()
+
+	var buf bytes.Buffer
+	v.write(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 4, len(lines), "Expected header lines plus one line per label value")
+	assert.Equal(t, `test_requests_total{command="get"} 2`, lines[2], "Expected label values in sorted order")
+	assert.Equal(t, `test_requests_total{command="set"} 2`, lines[3])
+}
+
+func Test_Gauge(t *testing.T) {
+	g := NewGauge("test_gauge", "A test gauge.")
+	g.Set(42)
+	g.Set(7)
+	assert.Equal(t, float64(7), g.Value())
+}
+
+func Test_Histogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.ObserveDuration(2 * time.Second)
+	assert.Equal(t, uint64(3), h.Count())
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE test_duration_seconds histogram\n")
+	assert.Contains(t, out, "test_duration_seconds_bucket{le=\"0.1\"} 1\n", "Expected buckets to be cumulative")
+	assert.Contains(t, out, "test_duration_seconds_bucket{le=\"1\"} 2\n")
+	assert.Contains(t, out, "test_duration_seconds_bucket{le=\"+Inf\"} 3\n")
+	assert.Contains(t, out, "test_duration_seconds_sum 2.55\n")
+	assert.Contains(t, out, "test_duration_seconds_count 3\n")
+}
+
+func Test_HistogramVec(t *testing.T) {
+	v := NewHistogramVec("test_request_seconds", "Latency.", "command", []float64{1})
+	v.With(`we"ird`).Observe(0.5)
+
+	var buf bytes.Buffer
+	v.write(&buf)
+	assert.Contains(t, buf.String(), "test_request_seconds_bucket{command=\"we\\\"ird\",le=\"1\"} 1\n", "Expected escaped label value")
+	assert.Contains(t, buf.String(), "test_request_seconds_count{command=\"we\\\"ird\"} 1\n")
+}
+
+func Test_Handler(t *testing.T) {
+	NewCounter("test_handler_total", "Handler test.").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "test_handler_total 1\n")
+}
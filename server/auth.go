@@ -0,0 +1,287 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/Panda-Home/bitcask/logging"
+	"github.com/Panda-Home/bitcask/utils"
+)
+
+var (
+	errAuthRequired = errors.New("Authentication required")
+	errAuthFailed   = errors.New("Invalid username or password")
+)
+
+// category is a set of commands users are given access to
+type category uint8
+
+const (
+	categoryRead category = 1 << iota
+	categoryWrite
+	categoryAdmin
+	categoryNone category = 0 // commands anyone may run
+)
+
+var categoryNames = map[string]category{
+	"read":  categoryRead,
+	"write": categoryWrite,
+	"admin": categoryAdmin,
+}
+
+// commandACL tells which category a command belongs to and which of
+// its arguments are keys
+type commandACL struct {
+	category category
+	keys     func(tokens []string) []string
+}
+
+// commandACLs lists every command, those missing from it are only
+// allowed to admin users
+var commandACLs = map[string]commandACL{
+	"ping": {categoryNone, nil},
+	"auth": {categoryNone, nil},
+
+	"get":        {categoryRead, firstKey},
+	"getv":       {categoryRead, firstKey},
+	"strlen":     {categoryRead, firstKey},
+	"getrange":   {categoryRead, firstKey},
+	"getstream":  {categoryRead, firstKey},
+	"mget":       {categoryRead, allKeys},
+	"exists":     {categoryRead, allKeys},
+	"watch":      {categoryRead, allKeys},
+	"keys":       {categoryRead, keysPattern},
+	"scan":       {categoryRead, scanPattern},
+	"range":      {categoryRead, rangeBounds},
+	"prefixscan": {categoryRead, firstKey},
+	"subscribe":  {categoryRead, subscribePrefix},
+
+	"set":         {categoryWrite, firstKey},
+	"del":         {categoryWrite, firstKey},
+	"setnx":       {categoryWrite, firstKey},
+	"setxx":       {categoryWrite, firstKey},
+	"cas":         {categoryWrite, firstKey},
+	"incr":        {categoryWrite, firstKey},
+	"decr":        {categoryWrite, firstKey},
+	"incrby":      {categoryWrite, firstKey},
+	"incrbyfloat": {categoryWrite, firstKey},
+	"append":      {categoryWrite, firstKey},
+	"setrange":    {categoryWrite, firstKey},
+	"setstream":   {categoryWrite, firstKey},
+	"mset":        {categoryWrite, msetKeys},
+	// queued writes are checked as they're queued
+	"batch":   {categoryWrite, nil},
+	"unwatch": {categoryWrite, nil},
+	"multi":   {categoryWrite, nil},
+	"exec":    {categoryWrite, nil},
+	"discard": {categoryWrite, nil},
+
+	"slowlog": {categoryAdmin, nil},
+	"client":  {categoryAdmin, nil},
+	"sync":    {categoryAdmin, nil},
+
+	"replication": {categoryAdmin, nil},
+}
+
+func firstKey(tokens []string) []string {
+	if len(tokens) < 2 {
+		return nil
+	}
+	return tokens[1:2]
+}
+
+func allKeys(tokens []string) []string {
+	return tokens[1:]
+}
+
+func msetKeys(tokens []string) []string {
+	var keys []string
+	for i := 1; i < len(tokens); i += 2 {
+		keys = append(keys, tokens[i])
+	}
+	return keys
+}
+
+// keysPattern returns the literal prefix of the pattern, every key
+// the command may return starts with it
+func keysPattern(tokens []string) []string {
+	if len(tokens) < 2 {
+		return nil
+	}
+	return []string{utils.GlobPrefix(tokens[1])}
+}
+
+// scanPattern returns the literal prefix of the pattern scan matches
+// keys with. A command which can't be parsed is checked as if it
+// matched every key, it fails to run anyway.
+func scanPattern(tokens []string) []string {
+	args, err := parseScanArgs(tokens)
+	if err != nil {
+		return []string{""}
+	}
+	return []string{utils.GlobPrefix(args.pattern)}
+}
+
+// subscribePrefix returns the prefix of subscribed keys, all of them
+// for *
+func subscribePrefix(tokens []string) []string {
+	if len(tokens) < 2 {
+		return nil
+	}
+	if tokens[1] == "*" {
+		return []string{""}
+	}
+	return tokens[1:2]
+}
+
+func rangeBounds(tokens []string) []string {
+	if len(tokens) < 3 {
+		return nil
+	}
+	return tokens[1:3]
+}
+
+// user is a user defined in config, along with its permissions
+type user struct {
+	name         string
+	passwordHash string
+	categories   category
+	keyPrefixes  []string // all keys when empty
+}
+
+// newUsers creates users from config, it returns nil when there's
+// none, meaning authentication is disabled
+func newUsers(cfgs []config.UserConfig) (map[string]*user, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	users := make(map[string]*user)
+	for _, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, errors.New("User name cannot be empty")
+		}
+		if _, ok := users[cfg.Name]; ok {
+			return nil, fmt.Errorf("Duplicate user: %s", cfg.Name)
+		}
+		if !utils.ValidPasswordHash(cfg.PasswordHash) {
+			return nil, fmt.Errorf("Invalid password hash of user %s", cfg.Name)
+		}
+		u := &user{
+			name:         cfg.Name,
+			passwordHash: cfg.PasswordHash,
+			keyPrefixes:  cfg.KeyPrefixes,
+		}
+		for _, name := range cfg.Categories {
+			cat, ok := categoryNames[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("Unknown category of user %s: %s", cfg.Name, name)
+			}
+			u.categories |= cat
+		}
+		users[cfg.Name] = u
+	}
+	return users, nil
+}
+
+// authorize tells if user may run the command of tokens
+func (u *user) authorize(tokens []string) error {
+	acl, ok := commandACLs[tokens[0]]
+	if !ok {
+		acl = commandACL{category: categoryAdmin}
+	}
+	if u.categories&acl.category != acl.category {
+		return fmt.Errorf("No permission to run %s", tokens[0])
+	}
+	if len(u.keyPrefixes) == 0 || acl.keys == nil {
+		return nil
+	}
+
+	keys := acl.keys(tokens)
+	if tokens[0] == "range" && len(keys) == 2 {
+		// both bounds have to be under one prefix, or keys of
+		// another prefix between them would be returned
+		for _, prefix := range u.keyPrefixes {
+			if strings.HasPrefix(keys[0], prefix) && strings.HasPrefix(keys[1], prefix) {
+				return nil
+			}
+		}
+		return fmt.Errorf("No permission to access range %s %s", keys[0], keys[1])
+	}
+	for _, key := range keys {
+		if !u.canAccess(key) {
+			return fmt.Errorf("No permission to access key %s", key)
+		}
+	}
+	return nil
+}
+
+func (u *user) canAccess(key string) bool {
+	for _, prefix := range u.keyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize checks the client may run the command of tokens, anything
+// goes when no user is configured. Commands outside of any category
+// may be run before authenticating.
+func (s *Server) authorize(c *client, tokens []string) error {
+	if s.users == nil {
+		return nil
+	}
+	if acl, ok := commandACLs[tokens[0]]; ok && acl.category == categoryNone {
+		return nil
+	}
+	if c.user == nil {
+		return errAuthRequired
+	}
+	return c.user.authorize(tokens)
+}
+
+// processAuthCommand handles: auth <user> <password>
+func (s *Server) processAuthCommand(c *client, tokens []string) ([]byte, error) {
+	if len(tokens) > 3 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 3 {
+		return nil, errTooFewArgs
+	}
+	if s.users == nil {
+		return nil, errors.New("Authentication is not enabled")
+	}
+	u, ok := s.users[tokens[1]]
+	if !ok || !utils.CheckPassword(u.passwordHash, tokens[2]) {
+		logging.Warn("Authentication failed", "client", c.addr, "user", tokens[1])
+		return nil, errAuthFailed
+	}
+	c.user = u
+	return []byte("OK"), nil
+}
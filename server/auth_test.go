@@ -0,0 +1,165 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/Panda-Home/bitcask/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAuthTestServer(t *testing.T) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "bitcask-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := utils.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(&config.BitcaskConfig{
+		Host:                "127.0.0.1",
+		DataDir:             dir,
+		DataSize:            1,
+		MaxValueSize:        1 << 20,
+		ShutdownGracePeriod: 10,
+		Users: []config.UserConfig{
+			{Name: "admin", PasswordHash: hash, Categories: []string{"read", "write", "admin"}},
+			{Name: "reader", PasswordHash: hash, Categories: []string{"read"}, KeyPrefixes: []string{"tenantA"}},
+			{Name: "writer", PasswordHash: hash, Categories: []string{"read", "write"}, KeyPrefixes: []string{"tenantA"}},
+		},
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	for _, key := range []string{"tenantA:1", "tenantA:2", "tenantB:secret"} {
+		assert.Nil(t, s.Set([]byte(key), []byte("v")))
+	}
+	return s, func() {
+		s.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_AuthRequired(t *testing.T) {
+	s, cleanup := newAuthTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := roundTrip(t, conn, r, "ping", "get tenantA:1", "keys *", "slowlog get", "batch begin", "auth reader nope", "get tenantA:1")
+	assert.Equal(t, []string{"PONG",
+		errAuthRequired.Error(), errAuthRequired.Error(), errAuthRequired.Error(), errAuthRequired.Error(),
+		errAuthFailed.Error(), errAuthRequired.Error()}, replies)
+
+	replies = roundTrip(t, conn, r, "auth admin secret", "get tenantB:secret", "slowlog len")
+	assert.Equal(t, []string{"OK", "v", "0"}, replies)
+}
+
+func Test_AuthCategories(t *testing.T) {
+	s, cleanup := newAuthTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := roundTrip(t, conn, r, "auth reader secret",
+		"get tenantA:1", "set tenantA:1 w", "del tenantA:1", "batch begin", "multi", "slowlog len", "client list", "bogus")
+	assert.Equal(t, []string{"OK", "v",
+		"No permission to run set", "No permission to run del", "No permission to run batch", "No permission to run multi",
+		"No permission to run slowlog", "No permission to run client", "No permission to run bogus"}, replies)
+
+	replies = roundTrip(t, conn, r, "auth writer secret", "set tenantA:1 w", "get tenantA:1", "slowlog len")
+	assert.Equal(t, []string{"OK", "OK", "w", "No permission to run slowlog"}, replies)
+}
+
+func Test_AuthKeyPrefixes(t *testing.T) {
+	s, cleanup := newAuthTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn, r, "auth writer secret"))
+
+	denied := map[string]string{
+		"get tenantB:secret":                      "No permission to access key tenantB:secret",
+		"mget tenantA:1 tenantB:secret":           "No permission to access key tenantB:secret",
+		"mset tenantA:1 x tenantB:secret x":       "No permission to access key tenantB:secret",
+		"keys *":                                  "No permission to access key ",
+		"keys tenant*":                            "No permission to access key tenant",
+		"scan 0":                                  "No permission to access key ",
+		"scan 0 match tenantB*":                   "No permission to access key tenantB",
+		"range tenantA tenantC":                   "No permission to access range tenantA tenantC",
+		"prefixscan tenant":                       "No permission to access key tenant",
+		"subscribe tenantB":                       "No permission to access key tenantB",
+		"subscribe *":                             "No permission to access key ",
+		"scan 0 match tenantA* match * count 100": "No permission to access key ",
+	}
+	for cmd, reply := range denied {
+		assert.Equal(t, []string{reply}, roundTrip(t, conn, r, cmd), cmd)
+	}
+
+	replies := roundTrip(t, conn, r,
+		"mget tenantA:1 tenantA:2",
+		"keys tenantA*",
+		"scan 0 match tenantA* count 100",
+		"range tenantA tenantA~",
+		"prefixscan tenantA:")
+	assert.Equal(t, []string{
+		"1\nv\n1\nv\n",
+		"tenantA:1\ntenantA:2",
+		"0\ntenantA:1\ntenantA:2",
+		"0\ntenantA:1\ntenantA:2",
+		"0\ntenantA:1\ntenantA:2",
+	}, replies)
+}
+
+func Test_AuthQueuedCommands(t *testing.T) {
+	s, cleanup := newAuthTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := roundTrip(t, conn, r, "auth writer secret",
+		"batch begin", "set tenantA:3 v", "set tenantB:secret w", "del tenantB:secret", "batch commit",
+		"multi", "set tenantA:4 v", "del tenantB:secret", "exec")
+	assert.Equal(t, []string{"OK",
+		"OK", "QUEUED", "No permission to access key tenantB:secret", "No permission to access key tenantB:secret", "OK",
+		"OK", "QUEUED", "No permission to access key tenantB:secret", "OK"}, replies)
+
+	for _, key := range []string{"tenantA:3", "tenantA:4", "tenantB:secret"} {
+		value, err := s.Get([]byte(key))
+		assert.Nil(t, err, key)
+		assert.Equal(t, []byte("v"), value, "Expected denied writes not to be queued")
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Panda-Home/bitcask/data"
+)
+
+var (
+	errBatchStarted    = errors.New("Batch already started")
+	errBatchNotStarted = errors.New("No batch started")
+	errNotQueueable    = errors.New("Only set and del can be queued")
+)
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// WriteBatch collects puts and deletes which are written to the data
+// file as one group, either all of them are applied or none is.
+type WriteBatch struct {
+	ops []batchOp
+}
+
+// NewWriteBatch creates an empty batch
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{}
+}
+
+// Put adds setting key to value to the batch
+func (b *WriteBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+}
+
+// Delete adds deleting key to the batch. Deleting a missing key
+// is a no-op instead of an error.
+func (b *WriteBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+}
+
+// Len returns the number of operations in the batch
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Write atomically applies all operations of the batch in order
+func (s *Server) Write(b *WriteBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.writeBatch(b)
+}
+
+func (s *Server) writeBatch(b *WriteBatch) error {
+	if s.IsReadOnly() {
+		return ErrReadOnly
+	}
+	// Existence of keys as of the previous operations in the batch,
+	// so that only deletes of existing keys are written.
+	exists := make(map[string]bool)
+	entries := make([]*data.Entry, 0, len(b.ops))
+	for _, op := range b.ops {
+		key := string(op.key)
+		if op.delete {
+			present, ok := exists[key]
+			if !ok {
+				present = s.keyDir.HasKey(op.key)
+			}
+			if !present {
+				continue
+			}
+		} else if len(op.value) == 0 {
+			return fmt.Errorf("Value cannot be empty: %s", op.key)
+		} else if int64(len(op.value)) > s.maxValueSize {
+			return ErrValueTooLarge
+		}
+		exists[key] = !op.delete
+
+		entry, err := s.newEntry(op.key, op.value)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	// Versions are only given away once the batch is known to be valid
+	for _, entry := range entries {
+		s.version++
+		entry.Version = s.version
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	batchBytes, err := data.DumpBatch(entries)
+	if err != nil {
+		return err
+	}
+	if _, err := s.logFile.Write(batchBytes); err != nil {
+		return fmt.Errorf("Failed to write batch: %s", err)
+	}
+
+	fileID := s.logFile.ActiveFilepath()
+	pos := s.logFile.ActiveFilePos() - int64(len(batchBytes))
+	s.appended(entries[len(entries)-1].Version, fileID, pos, int64(len(batchBytes)))
+	for _, entry := range entries {
+		if entry.IsTombstone() {
+			s.keyDir.DelKeydirEntry(entry.Key)
+		} else {
+			s.keyDir.SetEntry(entry.Key, data.NewKeyDirEntry(fileID, pos, entry))
+		}
+		pos += entry.Size()
+	}
+	return nil
+}
+
+// processMSetCommand handles: mset <key> <value> [<key> <value> ...]
+func (s *Server) processMSetCommand(tokens []string) ([]byte, error) {
+	if len(tokens) < 3 {
+		return nil, errTooFewArgs
+	}
+	if len(tokens)%2 == 0 {
+		return nil, errors.New("Wrong number of arguments")
+	}
+	b := NewWriteBatch()
+	for i := 1; i < len(tokens); i += 2 {
+		b.Put([]byte(tokens[i]), []byte(tokens[i+1]))
+	}
+	if err := s.Write(b); err != nil {
+		return nil, err
+	}
+	return []byte("OK"), nil
+}
+
+// processBatchCommand handles: batch begin|commit|discard
+func (s *Server) processBatchCommand(c *client, tokens []string) ([]byte, error) {
+	if len(tokens) > 2 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	switch tokens[1] {
+	case "begin":
+		if c.batch != nil {
+			return nil, errBatchStarted
+		}
+		if c.multi {
+			return nil, errMultiStarted
+		}
+		c.batch = NewWriteBatch()
+		return []byte("OK"), nil
+	case "commit":
+		if c.batch == nil {
+			return nil, errBatchNotStarted
+		}
+		b := c.batch
+		c.batch = nil
+		if err := s.Write(b); err != nil {
+			return nil, err
+		}
+		return []byte("OK"), nil
+	case "discard":
+		if c.batch == nil {
+			return nil, errBatchNotStarted
+		}
+		c.batch = nil
+		return []byte("OK"), nil
+	default:
+		return nil, errUnknownCommand
+	}
+}
+
+// isQueueControl tells if cmd starts or ends a batch or a transaction,
+// those are the writes allowed besides queued ones while one is open
+func isQueueControl(cmd string) bool {
+	switch cmd {
+	case "batch", "multi", "exec", "discard", "unwatch":
+		return true
+	}
+	return false
+}
+
+// queueBatchCommand adds set and del commands sent between batch
+// begin and batch commit, or after multi, to the pending batch b
+func queueBatchCommand(b *WriteBatch, tokens []string) ([]byte, error) {
+	switch tokens[0] {
+	case "set":
+		if len(tokens) > 3 {
+			return nil, errTooManyArgs
+		}
+		if len(tokens) < 3 {
+			return nil, errTooFewArgs
+		}
+		b.Put([]byte(tokens[1]), []byte(tokens[2]))
+	case "del":
+		if len(tokens) > 2 {
+			return nil, errTooManyArgs
+		}
+		if len(tokens) < 2 {
+			return nil, errTooFewArgs
+		}
+		b.Delete([]byte(tokens[1]))
+	}
+	return []byte("QUEUED"), nil
+}
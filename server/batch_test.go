@@ -0,0 +1,56 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BatchCommands(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := roundTrip(t, conn, r,
+		"set a 1", "batch begin", "set b 2", "del a", "get b", "batch commit", "get a", "get b")
+	assert.Equal(t, []string{"OK", "OK", "QUEUED", "QUEUED", "Key not found: b", "OK", "Key not found: a", "2"}, replies)
+
+	// Writes which can't be queued are rejected rather than applied
+	// outside of the batch
+	replies = roundTrip(t, conn, r,
+		"batch begin", "set c 3", "incr n", "mset x 1 y 2", "append b zz", "setnx z 1", "batch discard",
+		"get c", "get n", "get x", "get b", "get z")
+	assert.Equal(t, []string{"OK", "QUEUED",
+		errNotQueueable.Error(), errNotQueueable.Error(), errNotQueueable.Error(), errNotQueueable.Error(), "OK",
+		"Key not found: c", "Key not found: n", "Key not found: x", "2", "Key not found: z"}, replies)
+
+	replies = roundTrip(t, conn, r, "batch commit", "batch begin", "batch begin", "multi", "batch discard")
+	assert.Equal(t, []string{errBatchNotStarted.Error(), "OK", errBatchStarted.Error(), errBatchStarted.Error(), "OK"}, replies)
+}
@@ -0,0 +1,153 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrConditionFailed is returned by conditional writes when the key
+// isn't in the expected state. Nothing is written in that case.
+var ErrConditionFailed = errors.New("Condition failed")
+
+// SetNX sets key only if it doesn't exist and returns the version
+// given to the new value
+func (s *Server) SetNX(key, value []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keyDir.HasKey(key) {
+		return 0, ErrConditionFailed
+	}
+	if err := s.setKeyValue(key, value); err != nil {
+		return 0, err
+	}
+	return s.version, nil
+}
+
+// SetXX sets key only if it already exists and returns the version
+// given to the new value
+func (s *Server) SetXX(key, value []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.keyDir.HasKey(key) {
+		return 0, ErrConditionFailed
+	}
+	if err := s.setKeyValue(key, value); err != nil {
+		return 0, err
+	}
+	return s.version, nil
+}
+
+// CompareAndSwap sets key only if its current version is version and
+// returns the version given to the new value. A missing key never
+// matches, SetNX creates keys. Entries written before versions
+// existed have version 0.
+func (s *Server) CompareAndSwap(key []byte, version uint64, value []byte) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.keyDir.GetValue(key)
+	if err != nil || entry.Version != version {
+		return 0, ErrConditionFailed
+	}
+	if err := s.setKeyValue(key, value); err != nil {
+		return 0, err
+	}
+	return s.version, nil
+}
+
+// GetWithVersion returns the value of key along with its version,
+// to be given to CompareAndSwap later
+func (s *Server) GetWithVersion(key []byte) ([]byte, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.keyDir.GetValue(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, err := s.readValueFromFile(entry.FileID, entry.ValuePos, entry.ValueSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, entry.Version, nil
+}
+
+// processConditionalSetCommand handles:
+// setnx <key> <value>, setxx <key> <value>, cas <key> <version> <value>
+func (s *Server) processConditionalSetCommand(tokens []string) ([]byte, error) {
+	argc := 3
+	if tokens[0] == "cas" {
+		argc = 4
+	}
+	if len(tokens) > argc {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < argc {
+		return nil, errTooFewArgs
+	}
+
+	var (
+		version uint64
+		err     error
+	)
+	key := []byte(tokens[1])
+	switch tokens[0] {
+	case "setnx":
+		version, err = s.SetNX(key, []byte(tokens[2]))
+	case "setxx":
+		version, err = s.SetXX(key, []byte(tokens[2]))
+	default:
+		expected, perr := strconv.ParseUint(tokens[2], 10, 64)
+		if perr != nil {
+			return nil, fmt.Errorf("Not a valid version: %s", tokens[2])
+		}
+		version, err = s.CompareAndSwap(key, expected, []byte(tokens[3]))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.FormatUint(version, 10)), nil
+}
+
+// processGetVCommand handles getv <key>, the reply is the version
+// followed by the value
+func (s *Server) processGetVCommand(tokens []string) ([]byte, error) {
+	if len(tokens) > 2 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	value, version, err := s.GetWithVersion([]byte(tokens[1]))
+	if err != nil {
+		return nil, err
+	}
+	return formatList([][]byte{[]byte(strconv.FormatUint(version, 10)), value}), nil
+}
@@ -0,0 +1,89 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"fmt"
+	"testing"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConditionalWrites(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	v1, err := s.SetNX([]byte("a"), []byte("1"))
+	assert.Nil(t, err)
+	_, err = s.SetNX([]byte("a"), []byte("2"))
+	assert.Equal(t, ErrConditionFailed, err, "Expected setnx to fail on an existing key")
+	_, err = s.SetXX([]byte("b"), []byte("1"))
+	assert.Equal(t, ErrConditionFailed, err, "Expected setxx to fail on a missing key")
+	assert.False(t, s.keyDir.HasKey([]byte("b")))
+	v2, err := s.SetXX([]byte("a"), []byte("2"))
+	assert.Nil(t, err)
+	assert.True(t, v2 > v1)
+
+	_, err = s.CompareAndSwap([]byte("a"), v1, []byte("3"))
+	assert.Equal(t, ErrConditionFailed, err, "Expected cas to fail on a stale version")
+	_, err = s.CompareAndSwap([]byte("missing"), 0, []byte("3"))
+	assert.Equal(t, ErrConditionFailed, err, "Expected cas to fail on a missing key")
+	v3, err := s.CompareAndSwap([]byte("a"), v2, []byte("3"))
+	assert.Nil(t, err)
+	value, version, err := s.GetWithVersion([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, "3", string(value))
+	assert.Equal(t, v3, version)
+
+	// Versions are rebuilt from data files and keep increasing
+	s.Stop()
+	reopened, err := NewServer(&config.BitcaskConfig{Host: "127.0.0.1", DataDir: s.dataDir, DataSize: 1, MaxValueSize: 1 << 20})
+	assert.Nil(t, err)
+	defer reopened.Stop()
+	_, version, err = reopened.GetWithVersion([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, v3, version)
+	assert.Equal(t, v3, reopened.Version())
+	v4, err := reopened.CompareAndSwap([]byte("a"), v3, []byte("4"))
+	assert.Nil(t, err)
+	assert.Equal(t, v3+1, v4)
+}
+
+func Test_ConditionalWriteCommands(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := roundTrip(t, conn, r, "setnx a 1", "setnx a 2", "setxx b 1", "setxx a 2", "getv a")
+	assert.Equal(t, []string{"1", ErrConditionFailed.Error(), ErrConditionFailed.Error(), "2", "2\n2"}, replies)
+
+	replies = roundTrip(t, conn, r, "cas a 1 3", "cas a 2 3", "get a", "cas a x 4", "cas a 3", "getv missing")
+	assert.Equal(t, []string{ErrConditionFailed.Error(), "3", "3", "Not a valid version: x", errTooFewArgs.Error(),
+		fmt.Sprintf("Key not found: %s", "missing")}, replies)
+}
@@ -0,0 +1,225 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errTooManyClients = errors.New("Too many clients")
+	errNoSuchClient   = errors.New("No such client")
+)
+
+// clientRegistry keeps track of open connections
+type clientRegistry struct {
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	lastID  uint64
+	closed  bool // set on shutdown, no client is added afterwards
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{clients: make(map[*client]struct{})}
+}
+
+// add registers c and gives it an id, unless max clients are already
+// connected or the server is stopping. There's no limit when max is 0.
+func (r *clientRegistry) add(c *client, max int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return errShuttingDown
+	}
+	if max > 0 && len(r.clients) >= max {
+		return errTooManyClients
+	}
+	r.lastID++
+	c.id = r.lastID
+	c.addr = clientAddr(c.conn, c.id)
+	r.clients[c] = struct{}{}
+	return nil
+}
+
+func (r *clientRegistry) remove(c *client) {
+	r.mu.Lock()
+	delete(r.clients, c)
+	r.mu.Unlock()
+}
+
+func (r *clientRegistry) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.clients)
+}
+
+// list returns connected clients by id
+func (r *clientRegistry) list() []*client {
+	r.mu.Lock()
+	clients := make([]*client, 0, len(r.clients))
+	for c := range r.clients {
+		clients = append(clients, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
+
+// interrupt unblocks reads waiting for commands, and stops adding
+// clients. Clients running a command are left alone, the command loop
+// sees the server is stopping once it's done.
+func (r *clientRegistry) interrupt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for c := range r.clients {
+		if atomic.LoadInt32(&c.busy) == 0 {
+			c.conn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+// closeAll closes every connection
+func (r *clientRegistry) closeAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for c := range r.clients {
+		c.conn.Close()
+	}
+}
+
+// newClient creates the state of conn
+func newClient(conn net.Conn) *client {
+	now := time.Now()
+	return &client{
+		conn:        conn,
+		r:           bufio.NewReader(conn),
+		w:           bufio.NewWriter(conn),
+		addr:        clientAddr(conn, 0),
+		connectedAt: now,
+		lastActive:  now,
+	}
+}
+
+// begin records the command the client runs, for client list and
+// shutdown
+func (c *client) begin(command string) {
+	atomic.StoreInt32(&c.busy, 1)
+	c.mu.Lock()
+	c.lastActive = time.Now()
+	c.lastCmd = command
+	if c.user != nil {
+		c.userName = c.user.name
+	}
+	c.mu.Unlock()
+}
+
+func (c *client) end() {
+	atomic.StoreInt32(&c.busy, 0)
+}
+
+// kill closes the connection of c from another connection
+func (c *client) kill() {
+	atomic.StoreInt32(&c.killed, 1)
+	c.conn.Close()
+}
+
+func (c *client) isKilled() bool {
+	return atomic.LoadInt32(&c.killed) == 1
+}
+
+func (c *client) info(now time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("id=%d addr=%s age=%d idle=%d user=%s cmd=%s", c.id, c.addr,
+		int64(now.Sub(c.connectedAt).Seconds()), int64(now.Sub(c.lastActive).Seconds()),
+		c.userName, c.lastCmd)
+}
+
+// processClientCommand handles: client list|kill <addr>|kill id <id>
+func (s *Server) processClientCommand(c *client, tokens []string) ([]byte, error) {
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	switch tokens[1] {
+	case "list":
+		if len(tokens) > 2 {
+			return nil, errTooManyArgs
+		}
+		var buf bytes.Buffer
+		now := time.Now()
+		for i, other := range s.clients.list() {
+			if i > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(other.info(now))
+		}
+		return buf.Bytes(), nil
+	case "kill":
+		if len(tokens) > 4 {
+			return nil, errTooManyArgs
+		}
+		if len(tokens) < 3 || (tokens[2] == "id" && len(tokens) < 4) {
+			return nil, errTooFewArgs
+		}
+		match := func(other *client) bool { return other.addr == tokens[2] }
+		if tokens[2] == "id" {
+			id, err := strconv.ParseUint(tokens[3], 10, 64)
+			if err != nil {
+				return nil, errNoSuchClient
+			}
+			match = func(other *client) bool { return other.id == id }
+		} else if len(tokens) > 3 {
+			return nil, errTooManyArgs
+		}
+		for _, other := range s.clients.list() {
+			if !match(other) {
+				continue
+			}
+			if other == c {
+				// replied to before closing
+				c.closing = true
+			} else {
+				other.kill()
+			}
+			return []byte("OK"), nil
+		}
+		return nil, errNoSuchClient
+	default:
+		return nil, errUnknownCommand
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClientsTestServer(t *testing.T, maxClients, idleTimeout int) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "bitcask-clients")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(&config.BitcaskConfig{
+		Host:         "127.0.0.1",
+		DataDir:      dir,
+		DataSize:     1,
+		MaxValueSize: 1 << 20,
+		MaxClients:   maxClients,
+		IdleTimeout:  idleTimeout,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_MaxClients(t *testing.T) {
+	s, cleanup := newClientsTestServer(t, 2, 0)
+	defer cleanup()
+
+	conn1 := dialTestServer(t, s)
+	defer conn1.Close()
+	r1 := bufio.NewReader(conn1)
+	conn2 := dialTestServer(t, s)
+	defer conn2.Close()
+	r2 := bufio.NewReader(conn2)
+	assert.Equal(t, []string{"PONG"}, roundTrip(t, conn1, r1, "ping"))
+	assert.Equal(t, []string{"PONG"}, roundTrip(t, conn2, r2, "ping"))
+
+	conn3 := dialTestServer(t, s)
+	r3 := bufio.NewReader(conn3)
+	reply, err := readReply(r3)
+	assert.Nil(t, err)
+	assert.Equal(t, "Too many clients", reply)
+	_, err = readReply(r3)
+	assert.Error(t, err, "Expected the rejected connection to be closed")
+	conn3.Close()
+
+	// the slot of a client is freed once it disconnects
+	conn2.Close()
+	for s.clients.len() > 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn4 := dialTestServer(t, s)
+	defer conn4.Close()
+	assert.Equal(t, []string{"PONG"}, roundTrip(t, conn4, bufio.NewReader(conn4), "ping"))
+}
+
+func Test_IdleTimeout(t *testing.T) {
+	s, cleanup := newClientsTestServer(t, 0, 1)
+	defer cleanup()
+
+	idle := dialTestServer(t, s)
+	defer idle.Close()
+	idleReader := bufio.NewReader(idle)
+	assert.Equal(t, []string{"PONG"}, roundTrip(t, idle, idleReader, "ping"))
+	active := dialTestServer(t, s)
+	defer active.Close()
+	activeReader := bufio.NewReader(active)
+
+	start := time.Now()
+	for time.Since(start) < 1500*time.Millisecond {
+		assert.Equal(t, []string{"PONG"}, roundTrip(t, active, activeReader, "ping"))
+		time.Sleep(100 * time.Millisecond)
+	}
+	_, err := readReply(idleReader)
+	assert.Error(t, err, "Expected the idle connection to be closed")
+	assert.Equal(t, []string{"PONG"}, roundTrip(t, active, activeReader, "ping"), "Expected the active connection to be kept")
+}
+
+// clientIDs returns the ids and addresses of clients in a client list reply
+func clientIDs(list string) map[string]string {
+	ids := make(map[string]string)
+	for _, m := range regexp.MustCompile(`id=(\d+) addr=(\S+)`).FindAllStringSubmatch(list, -1) {
+		ids[m[2]] = m[1]
+	}
+	return ids
+}
+
+func Test_ClientCommand(t *testing.T) {
+	s, cleanup := newClientsTestServer(t, 0, 0)
+	defer cleanup()
+
+	conn1 := dialTestServer(t, s)
+	defer conn1.Close()
+	r1 := bufio.NewReader(conn1)
+	conn2 := dialTestServer(t, s)
+	defer conn2.Close()
+	r2 := bufio.NewReader(conn2)
+	conn3 := dialTestServer(t, s)
+	defer conn3.Close()
+	r3 := bufio.NewReader(conn3)
+	assert.Equal(t, []string{"v"}, roundTrip(t, conn2, r2, "set k v", "get k")[1:])
+
+	list := roundTrip(t, conn1, r1, "client list")[0]
+	lines := strings.Split(list, "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^id=\d+ addr=\S+ age=\d+ idle=\d+ user= cmd=client$`, lines[0])
+	ids := clientIDs(list)
+	addr1, addr2, addr3 := conn1.LocalAddr().String(), conn2.LocalAddr().String(), conn3.LocalAddr().String()
+	assert.Contains(t, ids, addr1)
+	assert.Contains(t, ids, addr2)
+	assert.Contains(t, ids, addr3)
+	assert.Regexp(t, fmt.Sprintf(`id=%s addr=%s age=\d+ idle=\d+ user= cmd=get`, ids[addr2], regexp.QuoteMeta(addr2)), list)
+
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn1, r1, "client kill "+addr2))
+	_, err := readReply(r2)
+	assert.Error(t, err, "Expected the client killed by address to be disconnected")
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn1, r1, "client kill id "+ids[addr3]))
+	_, err = readReply(r3)
+	assert.Error(t, err, "Expected the client killed by id to be disconnected")
+
+	assert.Equal(t, []string{
+		"No such client",
+		"No such client",
+		"No such client",
+		"Too few arguments",
+		"Too few arguments",
+		"Too many arguments",
+		"Unknown command",
+	}, roundTrip(t, conn1, r1,
+		"client kill "+addr2,
+		"client kill id "+ids[addr3],
+		"client kill id nope",
+		"client kill",
+		"client kill id",
+		"client kill "+addr2+" extra",
+		"client nope",
+	))
+	for s.clients.len() > 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, map[string]string{addr1: ids[addr1]}, clientIDs(roundTrip(t, conn1, r1, "client list")[0]))
+
+	// a client killing itself gets its reply before being disconnected
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn1, r1, "client kill id "+ids[addr1]))
+	_, err = readReply(r1)
+	assert.Error(t, err)
+}
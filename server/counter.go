@@ -0,0 +1,139 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var (
+	errNotInteger = errors.New("Value is not an integer or out of range")
+	errNotFloat   = errors.New("Value is not a valid float")
+	errOverflow   = errors.New("Increment would overflow")
+)
+
+// IncrBy adds delta to the integer value of key and returns the new
+// value. A missing key counts as 0.
+func (s *Server) IncrBy(key []byte, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.currentValue(key)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(0)
+	if current != nil {
+		if n, err = strconv.ParseInt(string(current), 10, 64); err != nil {
+			return 0, errNotInteger
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, errOverflow
+	}
+	n += delta
+	if err := s.setKeyValue(key, []byte(strconv.FormatInt(n, 10))); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// IncrByFloat adds delta to the float value of key and returns the
+// new value. A missing key counts as 0.
+func (s *Server) IncrByFloat(key []byte, delta float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.currentValue(key)
+	if err != nil {
+		return 0, err
+	}
+	f := float64(0)
+	if current != nil {
+		if f, err = strconv.ParseFloat(string(current), 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, errNotFloat
+		}
+	}
+	f += delta
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errOverflow
+	}
+	if err := s.setKeyValue(key, []byte(formatFloat(f))); err != nil {
+		return 0, err
+	}
+	return f, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// processCounterCommand handles: incr <key>, decr <key>,
+// incrby <key> <delta> and incrbyfloat <key> <delta>
+func (s *Server) processCounterCommand(tokens []string) ([]byte, error) {
+	argc := 2
+	if tokens[0] == "incrby" || tokens[0] == "incrbyfloat" {
+		argc = 3
+	}
+	if len(tokens) > argc {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < argc {
+		return nil, errTooFewArgs
+	}
+
+	key := []byte(tokens[1])
+	if tokens[0] == "incrbyfloat" {
+		delta, err := strconv.ParseFloat(tokens[2], 64)
+		if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+			return nil, fmt.Errorf("Not a valid float: %s", tokens[2])
+		}
+		f, err := s.IncrByFloat(key, delta)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(formatFloat(f)), nil
+	}
+
+	delta := int64(1)
+	switch tokens[0] {
+	case "decr":
+		delta = -1
+	case "incrby":
+		d, err := strconv.ParseInt(tokens[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Not a valid integer: %s", tokens[2])
+		}
+		delta = d
+	}
+	n, err := s.IncrBy(key, delta)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.FormatInt(n, 10)), nil
+}
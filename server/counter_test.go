@@ -0,0 +1,127 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IncrBy(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	n, err := s.IncrBy([]byte("n"), 5)
+	assert.Nil(t, err, "Expected a missing key to count as 0")
+	assert.Equal(t, int64(5), n)
+	n, err = s.IncrBy([]byte("n"), -7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-2), n)
+	value, _ := s.Get([]byte("n"))
+	assert.Equal(t, "-2", string(value))
+
+	assert.Nil(t, s.Set([]byte("text"), []byte("abc")))
+	_, err = s.IncrBy([]byte("text"), 1)
+	assert.Equal(t, errNotInteger, err)
+	assert.Nil(t, s.Set([]byte("float"), []byte("1.5")))
+	_, err = s.IncrBy([]byte("float"), 1)
+	assert.Equal(t, errNotInteger, err)
+
+	assert.Nil(t, s.Set([]byte("max"), []byte(strconv.FormatInt(math.MaxInt64, 10))))
+	_, err = s.IncrBy([]byte("max"), 1)
+	assert.Equal(t, errOverflow, err)
+	n, err = s.IncrBy([]byte("max"), math.MinInt64)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), n)
+	assert.Nil(t, s.Set([]byte("min"), []byte(strconv.FormatInt(math.MinInt64, 10))))
+	_, err = s.IncrBy([]byte("min"), -1)
+	assert.Equal(t, errOverflow, err)
+	value, _ = s.Get([]byte("min"))
+	assert.Equal(t, strconv.FormatInt(math.MinInt64, 10), string(value), "Expected nothing written on overflow")
+}
+
+func Test_IncrByFloat(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	f, err := s.IncrByFloat([]byte("f"), 0.1)
+	assert.Nil(t, err, "Expected a missing key to count as 0")
+	assert.Equal(t, 0.1, f)
+	f, err = s.IncrByFloat([]byte("f"), 0.2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.30000000000000004, f)
+	value, _ := s.Get([]byte("f"))
+	assert.Equal(t, "0.30000000000000004", string(value))
+
+	assert.Nil(t, s.Set([]byte("int"), []byte("2")))
+	f, err = s.IncrByFloat([]byte("int"), 1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.5, f)
+
+	for _, stored := range []string{"abc", "NaN", "Inf", "-Inf"} {
+		assert.Nil(t, s.Set([]byte("bad"), []byte(stored)))
+		_, err = s.IncrByFloat([]byte("bad"), 1)
+		assert.Equal(t, errNotFloat, err, "Expected %s to be rejected", stored)
+	}
+
+	assert.Nil(t, s.Set([]byte("big"), []byte(strconv.FormatFloat(math.MaxFloat64, 'f', -1, 64))))
+	_, err = s.IncrByFloat([]byte("big"), math.MaxFloat64)
+	assert.Equal(t, errOverflow, err)
+}
+
+func Test_CounterCommands(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		tokens   []string
+		expected string
+		err      string
+	}{
+		{[]string{"incr", "n"}, "1", ""},
+		{[]string{"incrby", "n", "10"}, "11", ""},
+		{[]string{"decr", "n"}, "10", ""},
+		{[]string{"incrby", "n", "1.5"}, "", "Not a valid integer: 1.5"},
+		{[]string{"incrbyfloat", "n", "1.5"}, "11.5", ""},
+		{[]string{"incrbyfloat", "n", "-0.5"}, "11", ""},
+		{[]string{"incrbyfloat", "n", "NaN"}, "", "Not a valid float: NaN"},
+		{[]string{"incrbyfloat", "n", "+Inf"}, "", "Not a valid float: +Inf"},
+		{[]string{"incrbyfloat", "f", "1e-7"}, "0.0000001", ""},
+		{[]string{"incr"}, "", errTooFewArgs.Error()},
+		{[]string{"incr", "n", "1"}, "", errTooManyArgs.Error()},
+		{[]string{"incrby", "n"}, "", errTooFewArgs.Error()},
+	} {
+		reply, err := s.processCounterCommand(tc.tokens)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, "%v", tc.tokens)
+			continue
+		}
+		assert.Nil(t, err, "%v", tc.tokens)
+		assert.Equal(t, tc.expected, string(reply), "%v", tc.tokens)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Panda-Home/bitcask/logging"
+	"github.com/Panda-Home/bitcask/metrics"
+)
+
+var (
+	requests            = metrics.NewCounterVec("bitcask_requests_total", "Number of processed commands.", "command")
+	requestDuration     = metrics.NewHistogramVec("bitcask_request_duration_seconds", "Command processing latency.", "command", nil)
+	keyDirKeys          = metrics.NewGauge("bitcask_keydir_keys", "Number of keys in KeyDir.")
+	connectedClients    = metrics.NewGauge("bitcask_connected_clients", "Number of open client connections.")
+	rejectedConnections = metrics.NewCounter("bitcask_rejected_connections_total", "Number of connections refused because of max_clients.")
+)
+
+// startHTTP starts the HTTP listener serving monitoring endpoints
+func (s *Server) startHTTP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Failed to listen on %s: %s", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	s.httpServer = &http.Server{Handler: mux}
+
+	logging.Info("HTTP listening", "addr", addr)
+	go func() {
+		if err := s.httpServer.Serve(l); err != nil && err != http.ErrServerClosed {
+			logging.Error("HTTP serve error", "err", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	// KeyDir size is only sampled on scrape to keep the write path cheap.
+	// It's left alone while loading since KeyDir is rebuilt unlocked.
+	if s.IsReady() {
+		s.mu.Lock()
+		keyDirKeys.Set(float64(s.keyDir.Len()))
+		s.mu.Unlock()
+	}
+
+	connectedClients.Set(float64(s.clients.len()))
+
+	metrics.Handler().ServeHTTP(w, r)
+}
+
+// observeRequest records one processed command, commands the
+// server doesn't know are grouped together to bound label values.
+// Names are checked against commandACLs since a command may be
+// rejected before being dispatched, for instance without auth.
+func observeRequest(command string, err error, elapsed time.Duration) {
+	if _, ok := commandACLs[command]; !ok || err == errUnknownCommand {
+		command = "unknown"
+	}
+	requests.With(command).Inc()
+	if !streamingCommands[command] {
+		requestDuration.With(command).ObserveDuration(elapsed)
+	}
+}
+
+// handleHealthz reports liveness, the process is alive as long as it answers
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "OK")
+}
+
+// handleReadyz reports if the server is able to serve commands
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.IsReady() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		select {
+		case <-s.quit:
+			fmt.Fprintln(w, errShuttingDown)
+		default:
+			fmt.Fprintln(w, errLoading)
+		}
+		return
+	}
+	fmt.Fprintln(w, "OK")
+}
@@ -0,0 +1,96 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Panda-Home/bitcask/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ObserveRequest(t *testing.T) {
+	observeRequest("strlen", errors.New("Key not found: foo"), time.Millisecond)
+	observeRequest("bogus0", errUnknownCommand, time.Millisecond)
+	observeRequest("bogus1", errAuthRequired, time.Millisecond)
+	observeRequest("bogus2", errLoading, time.Millisecond)
+	observeRequest("batch", errUnknownCommand, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, `bitcask_requests_total{command="strlen"}`)
+	assert.Contains(t, body, `bitcask_requests_total{command="unknown"}`)
+	assert.NotContains(t, body, "bogus", "Expected unknown commands to share one label value")
+}
+
+func probe(handler http.HandlerFunc) (int, string) {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil))
+	return w.Code, w.Body.String()
+}
+
+func Test_HealthAndReadiness(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// as while KeyDir is being rebuilt
+	atomic.StoreInt32(&s.ready, 0)
+	code, body := probe(s.handleReadyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, errLoading.Error()+"\n", body)
+	code, body = probe(s.handleHealthz)
+	assert.Equal(t, http.StatusOK, code, "Expected a loading server to be alive")
+	assert.Equal(t, "OK\n", body)
+	assert.Equal(t, []string{errLoading.Error(), errLoading.Error()}, roundTrip(t, conn, r, "ping", "get k"))
+
+	atomic.StoreInt32(&s.ready, 1)
+	code, body = probe(s.handleReadyz)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "OK\n", body)
+	assert.Equal(t, []string{"PONG"}, roundTrip(t, conn, r, "ping"))
+
+	s.Shutdown()
+	code, body = probe(s.handleReadyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, errShuttingDown.Error()+"\n", body)
+	code, _ = probe(s.handleHealthz)
+	assert.Equal(t, http.StatusOK, code)
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	_, err := s.processCommand(newClient(server), []string{"ping"})
+	assert.Equal(t, errShuttingDown, err)
+}
@@ -27,6 +27,7 @@ package server
 import (
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/Panda-Home/bitcask/data"
 	"github.com/Panda-Home/bitcask/utils"
@@ -50,11 +51,49 @@ func (s *Server) Get(key []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	value, err := readValueFromFile(entry.FileID, entry.ValuePos, entry.ValueSize)
+	return s.readValueFromFile(entry.FileID, entry.ValuePos, entry.ValueSize)
+}
+
+// MGet returns the values of given keys in the same order, the
+// value of a missing key is nil
+func (s *Server) MGet(keys [][]byte) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]*data.KeyDirEntry, len(keys))
+	for i, key := range keys {
+		if entry, err := s.keyDir.GetValue(key); err == nil {
+			entries[i] = entry
+		}
+	}
+	return s.readValues(entries)
+}
+
+// Exists returns how many of given keys exist, a key given
+// several times is counted as many times
+func (s *Server) Exists(keys [][]byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, key := range keys {
+		if s.keyDir.HasKey(key) {
+			count++
+		}
+	}
+	return count
+}
+
+// StrLen returns the length of the value of key, 0 if it's missing
+func (s *Server) StrLen(key []byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.keyDir.GetValue(key)
 	if err != nil {
-		return nil, err
+		return 0
 	}
-	return value, nil
+	return int(entry.ValueLen())
 }
 
 func (s *Server) Del(key []byte) error {
@@ -78,11 +117,42 @@ func (s *Server) Del(key []byte) error {
 	return nil
 }
 
-func (s *Server) setKeyValue(key, value []byte) error {
+// newEntry creates the entry setting key to value, compressed if
+// value is large enough and encrypted if a key is configured
+func (s *Server) newEntry(key, value []byte) (*data.Entry, error) {
 	entry, err := data.NewEntry(key, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 {
+		return entry, nil
+	}
+	if s.codec != nil && len(value) >= s.compressMin {
+		if err := entry.Compress(s.codec); err != nil {
+			return nil, fmt.Errorf("Failed to compress value: %s", err)
+		}
+	}
+	if s.keyring != nil {
+		if err := s.keyring.Encrypt(entry); err != nil {
+			return nil, fmt.Errorf("Failed to encrypt value: %s", err)
+		}
+	}
+	return entry, nil
+}
+
+func (s *Server) setKeyValue(key, value []byte) error {
+	if s.IsReadOnly() {
+		return ErrReadOnly
+	}
+	if int64(len(value)) > s.maxValueSize {
+		return ErrValueTooLarge
+	}
+	entry, err := s.newEntry(key, value)
 	if err != nil {
 		return err
 	}
+	s.version++
+	entry.Version = s.version
 
 	entryBytes, err := entry.Dump()
 	if err != nil {
@@ -95,11 +165,50 @@ func (s *Server) setKeyValue(key, value []byte) error {
 	}
 	curPos := s.logFile.ActiveFilePos() - int64(len(entryBytes))
 	s.keyDir.SetEntryFromByteArray(s.logFile.ActiveFilepath(), curPos, entryBytes)
+	s.appended(entry.Version, s.logFile.ActiveFilepath(), curPos, int64(len(entryBytes)))
 
 	return nil
 }
 
-func readValueFromFile(filepath string, pos int64, vs uint32) ([]byte, error) {
+// readValues loads the values of given KeyDir entries, nil entries
+// get nil values. Each data file is opened once and read in order.
+func (s *Server) readValues(entries []*data.KeyDirEntry) ([][]byte, error) {
+	type valueRef struct {
+		idx int
+		pos int64
+	}
+	refsByFile := make(map[string][]valueRef)
+	for i, entry := range entries {
+		if entry != nil {
+			refsByFile[entry.FileID] = append(refsByFile[entry.FileID], valueRef{i, entry.ValuePos})
+		}
+	}
+
+	values := make([][]byte, len(entries))
+	for fileID, refs := range refsByFile {
+		sort.Slice(refs, func(i, j int) bool { return refs[i].pos < refs[j].pos })
+
+		f, err := os.OpenFile(fileID, os.O_RDONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open file: %s", err)
+		}
+		for _, ref := range refs {
+			entry, err := data.LoadFromFile(f, ref.pos)
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("Failed to load data from file: %s", err)
+			}
+			if values[ref.idx], err = entry.DecodedValue(s.keyring); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+		f.Close()
+	}
+	return values, nil
+}
+
+func (s *Server) readValueFromFile(filepath string, pos int64, vs uint32) ([]byte, error) {
 	fileSize, err := utils.GetFileSize(filepath)
 	if err != nil {
 		return nil, fmt.Errorf("Can't get file size: %s", err)
@@ -119,5 +228,5 @@ func readValueFromFile(filepath string, pos int64, vs uint32) ([]byte, error) {
 		return nil, fmt.Errorf("Failed to load data from file: %s", err)
 	}
 
-	return entry.Value, nil
+	return entry.DecodedValue(s.keyring)
 }
@@ -0,0 +1,85 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MultiKeyReads(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	// Values spread over two data files, read in an order which
+	// isn't the file order
+	large := bytes.Repeat([]byte("x"), 600*1024)
+	assert.Nil(t, s.Set([]byte("a"), []byte("1")))
+	assert.Nil(t, s.Set([]byte("large1"), large))
+	first := s.GetActiveFile()
+	assert.Nil(t, s.Set([]byte("large2"), large))
+	assert.Nil(t, s.Set([]byte("b"), []byte("(nil)")))
+	assert.NotEqual(t, first, s.GetActiveFile(), "Expected values in two data files")
+
+	keys := toKeys([]string{"b", "missing", "large2", "a", "large1", "a"})
+	values, err := s.MGet(keys)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("(nil)"), nil, large, []byte("1"), large, []byte("1")}, values)
+
+	assert.Equal(t, 4, s.Exists(toKeys([]string{"a", "missing", "b", "a", "large1"})))
+	assert.Equal(t, 0, s.Exists(toKeys([]string{"missing"})))
+	assert.Equal(t, len(large), s.StrLen([]byte("large1")))
+	assert.Equal(t, 1, s.StrLen([]byte("a")))
+	assert.Equal(t, 0, s.StrLen([]byte("missing")))
+}
+
+func Test_MGetCommand(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	_, err := s.SetStream([]byte("multiline"), strings.NewReader("line1\nline2"))
+	assert.Nil(t, err)
+
+	replies := roundTrip(t, conn, r, "set a (nil)", "mget a missing multiline", "exists a missing a", "strlen multiline", "mget")
+	assert.Equal(t, []string{"OK", "5\n(nil)\n0\n\n11\nline1\nline2\n", "2", "11", errTooFewArgs.Error()}, replies)
+
+	// Items are framed the same way as replies
+	items := bufio.NewReader(strings.NewReader(replies[1]))
+	var values []string
+	for {
+		item, err := readReply(items)
+		if err != nil {
+			break
+		}
+		values = append(values, item)
+	}
+	assert.Equal(t, []string{"(nil)", "", "line1\nline2"}, values)
+}
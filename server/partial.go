@@ -0,0 +1,200 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Panda-Home/bitcask/data"
+)
+
+// Append adds suffix to the end of the value of key and returns the
+// new length. A missing key is created with suffix as value.
+func (s *Server) Append(key, suffix []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, err := s.currentValue(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(suffix) == 0 {
+		return len(value), nil
+	}
+	if int64(len(value)+len(suffix)) > s.maxValueSize {
+		return 0, ErrValueTooLarge
+	}
+	value = append(value, suffix...)
+	if err := s.setKeyValue(key, value); err != nil {
+		return 0, err
+	}
+	return len(value), nil
+}
+
+// SetRange overwrites the value of key from offset with value and
+// returns the new length. The value is padded with zero bytes when
+// offset is past its end, a missing key counts as an empty value.
+func (s *Server) SetRange(key []byte, offset int64, value []byte) (int, error) {
+	if offset < 0 || int64(int(offset)) != offset {
+		return 0, errors.New("Offset is out of range")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.currentValue(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) == 0 {
+		return len(current), nil
+	}
+	// checked before the value is padded up to offset, without adding
+	// them up as offset may be large enough to overflow
+	if offset > s.maxValueSize-int64(len(value)) {
+		return 0, ErrValueTooLarge
+	}
+	end := int(offset) + len(value)
+	if end > len(current) {
+		current = append(current, make([]byte, end-len(current))...)
+	}
+	copy(current[offset:], value)
+	if err := s.setKeyValue(key, current); err != nil {
+		return 0, err
+	}
+	return len(current), nil
+}
+
+// GetRange returns the bytes of the value of key between start and
+// end, both included. Negative offsets count from the end of the
+// value. Only the requested bytes are read from the data file, unless
+// the value is stored compressed or encrypted.
+func (s *Server) GetRange(key []byte, start, end int64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.keyDir.GetValue(key)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(entry.ValueLen())
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end {
+		return []byte{}, nil
+	}
+	if entry.IsEncoded() {
+		// a compressed or encrypted value can only be read as a whole
+		value, err := s.readValueFromFile(entry.FileID, entry.ValuePos, entry.ValueSize)
+		if err != nil {
+			return nil, err
+		}
+		return value[start : end+1], nil
+	}
+
+	f, err := os.OpenFile(entry.FileID, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file: %s", err)
+	}
+	defer f.Close()
+	value, err := data.ReadValueRange(f, entry.ValuePos, uint32(len(key)), start, int(end-start+1))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read value range: %s", err)
+	}
+	return value, nil
+}
+
+// currentValue returns the value of key, nil if it's missing
+func (s *Server) currentValue(key []byte) ([]byte, error) {
+	entry, err := s.keyDir.GetValue(key)
+	if err != nil {
+		return nil, nil
+	}
+	return s.readValueFromFile(entry.FileID, entry.ValuePos, entry.ValueSize)
+}
+
+func (s *Server) processAppendCommand(tokens []string) ([]byte, error) {
+	if len(tokens) > 3 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 3 {
+		return nil, errTooFewArgs
+	}
+	n, err := s.Append([]byte(tokens[1]), []byte(tokens[2]))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Itoa(n)), nil
+}
+
+// processGetRangeCommand handles: getrange <key> <start> <end>
+func (s *Server) processGetRangeCommand(tokens []string) ([]byte, error) {
+	if len(tokens) > 4 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 4 {
+		return nil, errTooFewArgs
+	}
+	start, err := strconv.ParseInt(tokens[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Not a valid integer: %s", tokens[2])
+	}
+	end, err := strconv.ParseInt(tokens[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Not a valid integer: %s", tokens[3])
+	}
+	return s.GetRange([]byte(tokens[1]), start, end)
+}
+
+// processSetRangeCommand handles: setrange <key> <offset> <value>
+func (s *Server) processSetRangeCommand(tokens []string) ([]byte, error) {
+	if len(tokens) > 4 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 4 {
+		return nil, errTooFewArgs
+	}
+	offset, err := strconv.ParseInt(tokens[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Not a valid integer: %s", tokens[2])
+	}
+	n, err := s.SetRange([]byte(tokens[1]), offset, []byte(tokens[3]))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Itoa(n)), nil
+}
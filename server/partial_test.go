@@ -0,0 +1,113 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PartialCommands(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := roundTrip(t, conn, r,
+		"append k abc", "append k def", "get k",
+		"getrange k 0 2", "getrange k -3 -1", "getrange k 4 100", "getrange k -100 1", "getrange k 5 2",
+		"getrange missing 0 1", "getrange k a 1",
+		"setrange k 1 XY", "setrange k 8 z", "get k", "setrange new 2 ab", "get new",
+		"setrange k -1 x", "setrange k 9223372036854775807 x", "setrange k 99999999999999999999 x", "get k",
+	)
+	assert.Equal(t, []string{
+		"3", "6", "abcdef",
+		"abc", "def", "ef", "ab", "",
+		"Key not found: missing", "Not a valid integer: a",
+		"6", "9", "aXYdef\x00\x00z", "4", "\x00\x00ab",
+		"Offset is out of range", ErrValueTooLarge.Error(), "Not a valid integer: 99999999999999999999", "aXYdef\x00\x00z",
+	}, replies)
+}
+
+func Test_PartialEncodedValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcask-partial")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := NewServer(&config.BitcaskConfig{
+		Host:                 "127.0.0.1",
+		DataDir:              dir,
+		DataSize:             1,
+		MaxValueSize:         256,
+		Compression:          "flate",
+		CompressionThreshold: 16,
+	})
+	assert.Nil(t, err)
+	defer s.Stop()
+
+	key := []byte("k")
+	assert.Nil(t, s.Set(key, bytes.Repeat([]byte("a"), 200)))
+	entry, err := s.keyDir.GetValue(key)
+	assert.Nil(t, err)
+	assert.True(t, entry.IsEncoded(), "Expected the value to be stored compressed")
+
+	value, err := s.GetRange(key, 100, 102)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("aaa"), value)
+	value, err = s.GetRange(key, -2, 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("aa"), value)
+
+	n, err := s.SetRange(key, 198, []byte("bcd"))
+	assert.Nil(t, err)
+	assert.Equal(t, 201, n)
+	n, err = s.Append(key, []byte("ef"))
+	assert.Nil(t, err)
+	assert.Equal(t, 203, n)
+	value, err = s.GetRange(key, 197, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("abcdef"), value)
+
+	// the limit applies to the value once padded
+	_, err = s.SetRange(key, 255, []byte("xy"))
+	assert.Equal(t, ErrValueTooLarge, err)
+	_, err = s.SetRange(key, math.MaxInt64, []byte("x"))
+	assert.Equal(t, ErrValueTooLarge, err)
+	_, err = s.Append(key, bytes.Repeat([]byte("a"), 54))
+	assert.Equal(t, ErrValueTooLarge, err)
+	n, err = s.SetRange(key, 254, []byte("xy"))
+	assert.Nil(t, err)
+	assert.Equal(t, 256, n)
+	value, err = s.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, append(append(bytes.Repeat([]byte("a"), 197), "abcdef"...), append(make([]byte, 51), "xy"...)...), value)
+}
@@ -0,0 +1,117 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// maxCommandSize bounds command lines, larger values are sent with
+// setstream
+const maxCommandSize = 1 << 20
+
+var errCommandTooLong = errors.New("Command is too long")
+
+// readCommand reads the next command line from r, without its line
+// break. Blank lines are skipped. The last command may lack a line
+// break if the client closes its side of the connection after it.
+func readCommand(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		if len(line)+len(frag) > maxCommandSize {
+			return "", errCommandTooLong
+		}
+		line = append(line, frag...)
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(bytes.TrimSpace(line)) > 0:
+			return string(line), nil
+		case err != nil:
+			return "", err
+		case len(bytes.TrimSpace(line)) == 0:
+			line = line[:0]
+			continue
+		}
+		return string(line[:len(line)-1]), nil
+	}
+}
+
+// writeReply frames reply the way value chunks are: its size in
+// decimal on a line followed by the reply and a line break
+func writeReply(w *bufio.Writer, reply []byte) error {
+	w.WriteString(strconv.Itoa(len(reply)))
+	w.WriteByte('\n')
+	w.Write(reply)
+	return w.WriteByte('\n')
+}
+
+// formatFrames renders a reply made of several items which may span
+// lines or be empty, each one is framed as a reply of its own
+func formatFrames(items [][]byte) []byte {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	for _, item := range items {
+		writeReply(w, item)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// writeTypedReply writes a reply made of the type byte typ followed by
+// payload
+func writeTypedReply(w *bufio.Writer, typ byte, payload []byte) error {
+	w.WriteString(strconv.Itoa(len(payload) + 1))
+	w.WriteByte('\n')
+	w.WriteByte(typ)
+	w.Write(payload)
+	return w.WriteByte('\n')
+}
+
+// readFrame reads a reply written by writeReply or writeTypedReply,
+// replies larger than max are an error
+func readFrame(r *bufio.Reader, max int64) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseInt(string(bytes.TrimSpace(line)), 10, 64)
+	if err != nil || size < 0 {
+		return nil, errors.New("Invalid reply size")
+	}
+	if size > max {
+		return nil, errors.New("Reply is too large")
+	}
+	reply := make([]byte, size+1)
+	if _, err := io.ReadFull(r, reply); err != nil {
+		return nil, err
+	}
+	return reply[:size], nil
+}
@@ -0,0 +1,740 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Panda-Home/bitcask/data"
+	"github.com/Panda-Home/bitcask/logging"
+)
+
+// Replication frames are replies starting with their type
+const (
+	frameEntries  = 'E' // entries as written to data files, ending a write
+	framePart     = 'B' // entries of a batch too large for one frame, more follow
+	frameSnapshot = 'S' // end of the snapshot of a full sync
+	framePing     = 'P' // followed by the offset of the primary
+)
+
+const (
+	replicationPing    = time.Second
+	replicationTimeout = 10 * time.Second
+	maxReconnectDelay  = 30 * time.Second
+
+	// replicaOffsetFile holds the offset of a replica between runs,
+	// it's removed on start so that a crash leads to a full sync
+	replicaOffsetFile = "replica.offset"
+)
+
+var errReplicaBehind = errors.New("Replica fell behind the replication backlog")
+
+// logRecord locates a write appended to data files: one entry, or a
+// whole batch along with its commit record
+type logRecord struct {
+	version uint64 // of the last entry
+	fileID  string
+	pos     int64
+	size    int64
+}
+
+// replBacklog keeps the latest writes for replicas to catch up from,
+// it's guarded by Server.mu
+type replBacklog struct {
+	records []logRecord
+	maxLen  int
+	start   uint64        // records cover every version after it
+	notify  chan struct{} // closed and replaced on every write
+}
+
+func newReplBacklog(maxLen int, start uint64) *replBacklog {
+	if maxLen < 1 {
+		maxLen = 1
+	}
+	return &replBacklog{maxLen: maxLen, start: start, notify: make(chan struct{})}
+}
+
+func (b *replBacklog) add(rec logRecord) {
+	if len(b.records) >= b.maxLen {
+		b.start = b.records[0].version
+		b.records = b.records[1:]
+	}
+	b.records = append(b.records, rec)
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// since returns the records after version v, false if some of them
+// were dropped already
+func (b *replBacklog) since(v uint64) ([]logRecord, bool) {
+	if v < b.start {
+		return nil, false
+	}
+	i := sort.Search(len(b.records), func(i int) bool { return b.records[i].version > v })
+	return append([]logRecord(nil), b.records[i:]...), true
+}
+
+// dropThrough drops the records up to version v
+func (b *replBacklog) dropThrough(v uint64) {
+	i := sort.Search(len(b.records), func(i int) bool { return b.records[i].version > v })
+	b.records = b.records[i:]
+	if v > b.start {
+		b.start = v
+	}
+}
+
+// reset drops every record, replicas have to catch up from version v
+func (b *replBacklog) reset(v uint64) {
+	b.records = nil
+	b.start = v
+}
+
+// appended records a write to data files for replicas, it must be
+// called with s.mu held
+func (s *Server) appended(version uint64, fileID string, pos, size int64) {
+	s.backlog.add(logRecord{version: version, fileID: fileID, pos: pos, size: size})
+}
+
+// replicaInfo is a replica connected to this server
+type replicaInfo struct {
+	addr   string
+	offset uint64 // set atomically, version of the last write sent
+}
+
+// snapshot is the state of KeyDir at some version, the data files it
+// points to are held open so that merges can't remove them
+type snapshot struct {
+	version uint64
+	refs    []snapshotRef
+	files   map[string]*os.File
+}
+
+type snapshotRef struct {
+	fileID string
+	pos    int64
+}
+
+// newSnapshot must be called with s.mu held
+func (s *Server) newSnapshot() (*snapshot, error) {
+	snap := &snapshot{version: s.version, files: make(map[string]*os.File)}
+	var err error
+	s.keyDir.Ascend(nil, func(key []byte, entry *data.KeyDirEntry) bool {
+		if _, ok := snap.files[entry.FileID]; !ok {
+			f, ferr := os.Open(entry.FileID)
+			if ferr != nil {
+				err = fmt.Errorf("Failed to open file: %s", ferr)
+				return false
+			}
+			snap.files[entry.FileID] = f
+		}
+		snap.refs = append(snap.refs, snapshotRef{entry.FileID, entry.ValuePos})
+		return true
+	})
+	if err != nil {
+		snap.close()
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (snap *snapshot) close() {
+	for _, f := range snap.files {
+		f.Close()
+	}
+}
+
+// processSyncCommand handles: sync <offset>, sent by replicas. The
+// connection then carries replication frames until either side stops.
+func (s *Server) processSyncCommand(c *client, tokens []string) ([]byte, error) {
+	if len(tokens) > 2 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	offset, err := strconv.ParseUint(tokens[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("Invalid offset")
+	}
+	c.replied = true
+	c.closing = true
+	if err := s.serveReplica(c, offset); err != nil {
+		logging.Warn("Replica disconnected", "client", c.addr, "err", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// serveReplica sends the writes after offset to the replica of c, or a
+// full snapshot when the backlog doesn't have them all, then keeps
+// sending writes as they come in.
+func (s *Server) serveReplica(c *client, offset uint64) error {
+	info := &replicaInfo{addr: c.addr}
+	s.mu.Lock()
+	_, resume := s.backlog.since(offset)
+	// a replica ahead of this server has another history
+	resume = resume && offset > 0 && offset <= s.version
+	var snap *snapshot
+	if !resume {
+		var err error
+		if snap, err = s.newSnapshot(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		offset = snap.version
+	}
+	s.replicas[info] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.replicas, info)
+		s.mu.Unlock()
+	}()
+	atomic.StoreUint64(&info.offset, offset)
+
+	if snap == nil {
+		logging.Info("Replica resuming", "client", c.addr, "offset", offset)
+		if err := s.writeFrame(c, 0, []byte("CONTINUE")); err != nil {
+			return err
+		}
+	} else {
+		defer snap.close()
+		logging.Info("Full sync of replica", "client", c.addr, "offset", offset, "keys", len(snap.refs))
+		if err := s.writeFrame(c, 0, []byte(fmt.Sprintf("FULLSYNC %d", offset))); err != nil {
+			return err
+		}
+		for _, ref := range snap.refs {
+			select {
+			case <-s.quit:
+				return nil
+			default:
+			}
+			entry, err := data.LoadFromFile(snap.files[ref.fileID], ref.pos)
+			if err != nil {
+				return fmt.Errorf("Failed to load data from file: %s", err)
+			}
+			entry.Flags &^= data.FlagBatch
+			entryBytes, err := entry.Dump()
+			if err != nil {
+				return err
+			}
+			if err := s.writeFrame(c, frameEntries, entryBytes); err != nil {
+				return err
+			}
+		}
+		if err := s.writeFrame(c, frameSnapshot, nil); err != nil {
+			return err
+		}
+	}
+	return s.tailLog(c, info, offset)
+}
+
+// tailLog sends writes after offset as they're appended to data files
+func (s *Server) tailLog(c *client, info *replicaInfo, offset uint64) error {
+	var (
+		f      *os.File
+		fileID string
+	)
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for {
+		s.mu.Lock()
+		records, ok := s.backlog.since(offset)
+		notify := s.backlog.notify
+		version := s.version
+		s.mu.Unlock()
+		if !ok {
+			return errReplicaBehind
+		}
+
+		for _, rec := range records {
+			if rec.fileID != fileID {
+				if f != nil {
+					f.Close()
+				}
+				f, fileID = nil, rec.fileID
+				var err error
+				if f, err = os.Open(rec.fileID); err != nil {
+					// Merged away, replicas resuming from before it
+					// have to sync in full
+					s.mu.Lock()
+					s.backlog.dropThrough(rec.version)
+					s.mu.Unlock()
+					return fmt.Errorf("Failed to open file: %s", err)
+				}
+			}
+			if err := s.sendRecord(c, f, rec); err != nil {
+				return err
+			}
+			offset = rec.version
+			atomic.StoreUint64(&info.offset, offset)
+		}
+		if err := s.flush(c); err != nil {
+			return err
+		}
+
+		select {
+		case <-s.quit:
+			return nil
+		case <-notify:
+		case <-time.After(replicationPing):
+			if err := s.writeFrame(c, framePing, []byte(strconv.FormatUint(version, 10))); err != nil {
+				return err
+			}
+			if err := s.flush(c); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// maxFrameSize is the size of the largest replication frame, which
+// has room for an entry holding a value as large as allowed
+func (s *Server) maxFrameSize() int64 {
+	return s.maxValueSize + 1<<20
+}
+
+// sendRecord sends the write rec of f to c. A batch has no size limit,
+// a record too large for one frame is split between entries: its
+// first frames are sent as framePart and the replica only applies the
+// batch once the last one comes in.
+func (s *Server) sendRecord(c *client, f *os.File, rec logRecord) error {
+	maxSize := s.maxFrameSize()
+	for pos, end := rec.pos, rec.pos+rec.size; pos < end; {
+		size := end - pos
+		if size > maxSize {
+			// as many entries as fit, but at least one
+			size = 0
+			for pos+size < end {
+				vr, err := data.NewValueReader(f, pos+size)
+				if err != nil {
+					return fmt.Errorf("Failed to read file: %s", err)
+				}
+				entrySize := vr.Header().Size()
+				if size > 0 && size+entrySize > maxSize {
+					break
+				}
+				size += entrySize
+			}
+		}
+		frameBytes := make([]byte, size)
+		if _, err := f.ReadAt(frameBytes, pos); err != nil {
+			return fmt.Errorf("Failed to read file: %s", err)
+		}
+		pos += size
+		typ := byte(frameEntries)
+		if pos < end {
+			typ = framePart
+		}
+		if err := s.writeFrame(c, typ, frameBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFrame buffers a replication frame of type typ for c, typ 0
+// writes payload as a plain reply
+func (s *Server) writeFrame(c *client, typ byte, payload []byte) error {
+	if s.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	}
+	if typ == 0 {
+		return writeReply(c.w, payload)
+	}
+	return writeTypedReply(c.w, typ, payload)
+}
+
+// replica is the state of replication from a primary, guarded by
+// Server.mu
+type replica struct {
+	primary   string
+	user      string
+	password  string
+	tlsConfig *tls.Config // nil for plain TCP
+
+	state         string // connecting, syncing or streaming
+	offset        uint64 // version of the last write applied
+	primaryOffset uint64 // as of the last ping
+	lastContact   time.Time
+	fullSyncs     int
+}
+
+// loadReplicaOffset reads the offset saved by the previous run and
+// removes the file, 0 is returned when there's none
+func loadReplicaOffset(dir string) uint64 {
+	path := filepath.Join(dir, replicaOffsetFile)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	os.Remove(path)
+	offset, _ := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	return offset
+}
+
+// saveReplicaOffset records the offset for the next run, once data
+// files are synced
+func (s *Server) saveReplicaOffset() error {
+	path := filepath.Join(s.dataDir, replicaOffsetFile)
+	return ioutil.WriteFile(path, []byte(strconv.FormatUint(s.replica.offset, 10)), 0644)
+}
+
+// replicate keeps this server in sync with its primary until Shutdown
+func (s *Server) replicate() {
+	defer s.wg.Done()
+
+	delay := time.Second
+	for {
+		synced, err := s.syncFromPrimary()
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+		if synced {
+			delay = time.Second
+		}
+		logging.Warn("Replication interrupted", "primary", s.replica.primary, "err", err, "retry_in", delay)
+		s.setReplicaState("connecting")
+
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (s *Server) setReplicaState(state string) {
+	s.mu.Lock()
+	s.replica.state = state
+	s.mu.Unlock()
+}
+
+// syncFromPrimary connects to the primary and applies the writes it
+// sends until the connection fails. It tells if replication got in
+// sync in the meantime.
+func (s *Server) syncFromPrimary() (bool, error) {
+	r := s.replica
+	var (
+		conn net.Conn
+		err  error
+	)
+	if r.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: replicationTimeout}, "tcp", r.primary, r.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", r.primary, replicationTimeout)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.quit:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	maxFrame := s.maxFrameSize()
+	call := func(cmd string) (string, error) {
+		conn.SetDeadline(time.Now().Add(replicationTimeout))
+		if _, err := io.WriteString(conn, cmd+"\n"); err != nil {
+			return "", err
+		}
+		reply, err := readFrame(reader, maxFrame)
+		return string(reply), err
+	}
+	if r.user != "" {
+		reply, err := call(fmt.Sprintf("auth %s %s", r.user, r.password))
+		if err != nil {
+			return false, err
+		}
+		if reply != "OK" {
+			return false, fmt.Errorf("Failed to authenticate: %s", reply)
+		}
+	}
+
+	s.mu.Lock()
+	offset := r.offset
+	s.mu.Unlock()
+	reply, err := call(fmt.Sprintf("sync %d", offset))
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		synced bool
+		// keys received during a full sync, nil once in sync
+		snapshotKeys    map[string]struct{}
+		snapshotVersion uint64
+		// entries of a batch sent in several frames
+		partial []byte
+	)
+	switch {
+	case reply == "CONTINUE":
+		logging.Info("Resuming replication", "primary", r.primary, "offset", offset)
+		s.setReplicaState("streaming")
+		synced = true
+	case strings.HasPrefix(reply, "FULLSYNC "):
+		if snapshotVersion, err = strconv.ParseUint(strings.TrimPrefix(reply, "FULLSYNC "), 10, 64); err != nil {
+			return false, fmt.Errorf("Invalid reply: %s", reply)
+		}
+		logging.Info("Full sync from primary", "primary", r.primary, "offset", snapshotVersion)
+		snapshotKeys = make(map[string]struct{})
+		s.mu.Lock()
+		// an interrupted full sync has to start over
+		r.offset = 0
+		r.state = "syncing"
+		s.mu.Unlock()
+	default:
+		return false, errors.New(reply)
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(replicationTimeout))
+		frame, err := readFrame(reader, maxFrame)
+		if err != nil {
+			return synced, err
+		}
+		if len(frame) == 0 {
+			return synced, errors.New("Invalid replication frame")
+		}
+
+		switch frame[0] {
+		case framePart:
+			partial = append(partial, frame[1:]...)
+		case frameEntries:
+			recBytes := frame[1:]
+			if partial != nil {
+				recBytes = append(partial, recBytes...)
+				partial = nil
+			}
+			err = s.applyRecord(recBytes, snapshotKeys)
+		case frameSnapshot:
+			if snapshotKeys == nil {
+				return synced, errors.New("Unexpected end of snapshot")
+			}
+			err = s.finishFullSync(snapshotKeys, snapshotVersion)
+			snapshotKeys = nil
+			synced = true
+			logging.Info("Full sync done", "primary", r.primary, "offset", snapshotVersion)
+		case framePing:
+			var primaryOffset uint64
+			if primaryOffset, err = strconv.ParseUint(string(frame[1:]), 10, 64); err == nil {
+				s.mu.Lock()
+				r.primaryOffset = primaryOffset
+				r.lastContact = time.Now()
+				s.mu.Unlock()
+			}
+		default:
+			err = fmt.Errorf("Unknown replication frame: %c", frame[0])
+		}
+		if err != nil {
+			return synced, err
+		}
+	}
+}
+
+// applyRecord appends the entries of recBytes, as sent by the primary,
+// to data files. During a full sync their keys are added to
+// snapshotKeys, otherwise they're added to the backlog for replicas
+// of this server.
+func (s *Server) applyRecord(recBytes []byte, snapshotKeys map[string]struct{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		entries []*data.Entry
+		offsets []int64
+	)
+	err := data.LoadEntries(recBytes, func(entry *data.Entry, offset int64) error {
+		if entry.Flags&data.FlagBatchCommit != 0 {
+			return nil
+		}
+		if entry.Flags&data.FlagEncrypted != 0 && (s.keyring == nil || !s.keyring.HasKey(entry.KeyID)) {
+			return fmt.Errorf("Value of %s is encrypted with key %08x, which isn't configured", entry.Key, entry.KeyID)
+		}
+		entries = append(entries, entry)
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New("Empty replication record")
+	}
+	last := entries[len(entries)-1].Version
+	if snapshotKeys == nil && last <= s.replica.offset {
+		// already applied
+		return nil
+	}
+
+	if _, err := s.logFile.Write(recBytes); err != nil {
+		return fmt.Errorf("Failed to write replicated entries: %s", err)
+	}
+	fileID := s.logFile.ActiveFilepath()
+	pos := s.logFile.ActiveFilePos() - int64(len(recBytes))
+	for i, entry := range entries {
+		entry.Flags &^= data.FlagBatch
+		if entry.IsTombstone() {
+			s.keyDir.DelKeydirEntry(entry.Key)
+		} else {
+			s.keyDir.SetEntry(entry.Key, data.NewKeyDirEntry(fileID, pos+offsets[i], entry))
+		}
+		if snapshotKeys != nil {
+			snapshotKeys[string(entry.Key)] = struct{}{}
+		}
+		if entry.Version > s.version {
+			s.version = entry.Version
+		}
+	}
+	s.replica.lastContact = time.Now()
+	if snapshotKeys == nil {
+		s.replica.offset = last
+		s.appended(last, fileID, pos, int64(len(recBytes)))
+	}
+	return nil
+}
+
+// finishFullSync deletes the keys the primary didn't send, they were
+// deleted while this server wasn't in sync
+func (s *Server) finishFullSync(snapshotKeys map[string]struct{}, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stale [][]byte
+	s.keyDir.Ascend(nil, func(key []byte, _ *data.KeyDirEntry) bool {
+		if _, ok := snapshotKeys[string(key)]; !ok {
+			stale = append(stale, key)
+		}
+		return true
+	})
+	for _, key := range stale {
+		entry, err := data.NewEntry(key, nil)
+		if err != nil {
+			return err
+		}
+		entry.Version = version
+		entryBytes, err := entry.Dump()
+		if err != nil {
+			return err
+		}
+		if _, err := s.logFile.Write(entryBytes); err != nil {
+			return fmt.Errorf("Failed to delete stale key: %s", err)
+		}
+		s.keyDir.DelKeydirEntry(key)
+	}
+
+	r := s.replica
+	r.offset = version
+	r.state = "streaming"
+	r.fullSyncs++
+	if version > s.version {
+		s.version = version
+	}
+	// Replicas of this server have to sync in full as well
+	s.backlog.reset(version)
+	return nil
+}
+
+// processReplicationCommand handles: replication status
+func (s *Server) processReplicationCommand(tokens []string) ([]byte, error) {
+	if len(tokens) > 2 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	if tokens[1] != "status" {
+		return nil, errUnknownCommand
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lines []string
+	if r := s.replica; r != nil {
+		lag := uint64(0)
+		if r.primaryOffset > r.offset {
+			lag = r.primaryOffset - r.offset
+		}
+		lastContact := int64(-1)
+		if !r.lastContact.IsZero() {
+			lastContact = int64(time.Since(r.lastContact).Seconds())
+		}
+		lines = append(lines,
+			"role=replica",
+			"primary="+r.primary,
+			"state="+r.state,
+			fmt.Sprintf("offset=%d", r.offset),
+			fmt.Sprintf("primary_offset=%d", r.primaryOffset),
+			fmt.Sprintf("lag=%d", lag),
+			fmt.Sprintf("last_contact_seconds=%d", lastContact),
+			fmt.Sprintf("full_syncs=%d", r.fullSyncs))
+	} else {
+		lines = append(lines, "role=primary", fmt.Sprintf("offset=%d", s.version))
+	}
+	lines = append(lines,
+		fmt.Sprintf("backlog_start=%d", s.backlog.start),
+		fmt.Sprintf("replicas=%d", len(s.replicas)))
+
+	infos := make([]*replicaInfo, 0, len(s.replicas))
+	for info := range s.replicas {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].addr < infos[j].addr })
+	for _, info := range infos {
+		offset := atomic.LoadUint64(&info.offset)
+		lines = append(lines, fmt.Sprintf("replica addr=%s offset=%d lag=%d", info.addr, offset, s.version-offset))
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
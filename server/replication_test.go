@@ -0,0 +1,247 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestReplica(t *testing.T, dir string, primary *Server) *Server {
+	s, err := NewServer(&config.BitcaskConfig{
+		Host:                "127.0.0.1",
+		DataDir:             dir,
+		DataSize:            1,
+		MaxValueSize:        1 << 20,
+		WriteTimeout:        30,
+		ShutdownGracePeriod: 10,
+		ReplicaOf:           primary.listeners[0].Addr().String(),
+		ReplicationBacklog:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// waitInSync waits for replica to have applied every write of primary
+func waitInSync(t *testing.T, primary, replica *Server) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		primary.mu.Lock()
+		version := primary.version
+		primary.mu.Unlock()
+		replica.mu.Lock()
+		offset, state := replica.replica.offset, replica.replica.state
+		replica.mu.Unlock()
+		if offset == version && state == "streaming" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Replica didn't catch up with primary")
+}
+
+func assertReplicated(t *testing.T, replica *Server, expected map[string]string) {
+	keys, err := replica.Keys("*")
+	assert.Nil(t, err)
+	assert.Equal(t, len(expected), len(keys), "Expected the same keys as primary")
+	for key, value := range expected {
+		got, err := replica.Get([]byte(key))
+		assert.Nil(t, err, "Expected %s to be replicated", key)
+		assert.Equal(t, value, string(got))
+	}
+}
+
+func Test_Replication(t *testing.T) {
+	primary, cleanup := newTestServer(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "bitcask-replica")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// A key the replica has but the primary doesn't is deleted by the
+	// full sync
+	stale := newTestReplica(t, dir, primary)
+	stale.Stop()
+	os.Remove(dir + "/" + replicaOffsetFile)
+
+	expected := map[string]string{}
+	for i := 0; i < 50; i++ {
+		key, value := fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)
+		assert.Nil(t, primary.Set([]byte(key), []byte(value)))
+		expected[key] = value
+	}
+	assert.Nil(t, primary.Del([]byte("key0")))
+	delete(expected, "key0")
+
+	replica := newTestReplica(t, dir, primary)
+	waitInSync(t, primary, replica)
+	assertReplicated(t, replica, expected)
+	assert.Equal(t, ErrReadOnly, replica.Set([]byte("foo"), []byte("bar")), "Expected replicas to reject writes")
+
+	// Writes after the snapshot are streamed, batches included
+	b := NewWriteBatch()
+	b.Put([]byte("batch1"), []byte("v1"))
+	b.Put([]byte("batch2"), []byte("v2"))
+	b.Delete([]byte("key1"))
+	assert.Nil(t, primary.Write(b))
+	_, err = primary.SetStream([]byte("streamed"), strings.NewReader("streamed value"))
+	assert.Nil(t, err)
+	expected["batch1"], expected["batch2"], expected["streamed"] = "v1", "v2", "streamed value"
+	delete(expected, "key1")
+	waitInSync(t, primary, replica)
+	assertReplicated(t, replica, expected)
+
+	// A dropped connection resumes from the replica offset
+	for _, c := range primary.clients.list() {
+		c.kill()
+	}
+	assert.Nil(t, primary.Set([]byte("after-kill"), []byte("v")))
+	expected["after-kill"] = "v"
+	waitInSync(t, primary, replica)
+	assertReplicated(t, replica, expected)
+
+	// So does a restarted replica
+	replica.Stop()
+	assert.Nil(t, primary.Set([]byte("after-restart"), []byte("v")))
+	expected["after-restart"] = "v"
+	replica = newTestReplica(t, dir, primary)
+	waitInSync(t, primary, replica)
+	assertReplicated(t, replica, expected)
+
+	status, err := replica.processReplicationCommand([]string{"replication", "status"})
+	assert.Nil(t, err)
+	assert.Contains(t, string(status), "role=replica")
+	assert.Contains(t, string(status), "full_syncs=0", "Expected the restarted replica to resume")
+	status, err = primary.processReplicationCommand([]string{"replication", "status"})
+	assert.Nil(t, err)
+	assert.Contains(t, string(status), "role=primary")
+	assert.Contains(t, string(status), "replica addr=")
+
+	// A replica behind the backlog syncs in full again
+	replica.Stop()
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, primary.Set([]byte("key2"), []byte(fmt.Sprintf("value%d", i))))
+	}
+	expected["key2"] = "value199"
+	replica = newTestReplica(t, dir, primary)
+	defer replica.Stop()
+	waitInSync(t, primary, replica)
+	assertReplicated(t, replica, expected)
+	replica.mu.Lock()
+	assert.Equal(t, 1, replica.replica.fullSyncs)
+	replica.mu.Unlock()
+}
+
+func Test_ReplicationTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcask-replica-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	primaryDir, replicaDir := filepath.Join(dir, "primary"), filepath.Join(dir, "replica")
+	os.Mkdir(primaryDir, 0755)
+	os.Mkdir(replicaDir, 0755)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	ca := newTestCert(t, "ca", nil, file("ca.pem"), file("ca-key.pem"))
+	newTestCert(t, "primary", ca, file("primary.pem"), file("primary-key.pem"))
+	newTestCert(t, "replica", ca, file("replica.pem"), file("replica-key.pem"))
+
+	primary, err := NewServer(&config.BitcaskConfig{
+		Host:               "127.0.0.1",
+		DataDir:            primaryDir,
+		DataSize:           1,
+		MaxValueSize:       1 << 20,
+		ReplicationBacklog: 100,
+		TLSCertFile:        file("primary.pem"),
+		TLSKeyFile:         file("primary-key.pem"),
+		TLSClientCAFile:    file("ca.pem"),
+	})
+	assert.Nil(t, err)
+	defer primary.Stop()
+	assert.Nil(t, primary.Set([]byte("foo"), []byte("bar")))
+
+	c := &config.BitcaskConfig{
+		Host:               "127.0.0.1",
+		DataDir:            replicaDir,
+		DataSize:           1,
+		MaxValueSize:       1 << 20,
+		ReplicaOf:          primary.listeners[0].Addr().String(),
+		ReplicaTLS:         true,
+		ReplicaTLSCAFile:   file("ca.pem"),
+		ReplicaTLSCertFile: file("replica.pem"),
+	}
+	_, err = NewServer(c)
+	assert.EqualError(t, err, "replica_tls_key_file is required along with replica_tls_cert_file")
+
+	c.ReplicaTLSKeyFile = file("replica-key.pem")
+	replica, err := NewServer(c)
+	assert.Nil(t, err)
+	defer replica.Stop()
+	waitInSync(t, primary, replica)
+	assertReplicated(t, replica, map[string]string{"foo": "bar"})
+}
+
+func Test_ReplicationLargeBatch(t *testing.T) {
+	primary, cleanup := newTestServer(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "bitcask-replica")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, primary.Set([]byte("before"), []byte("v")))
+	replica := newTestReplica(t, dir, primary)
+	defer replica.Stop()
+	waitInSync(t, primary, replica)
+
+	// Larger than a replication frame, it has to be split and put
+	// back together by the replica
+	expected := map[string]string{"before": "v"}
+	b := NewWriteBatch()
+	for i := 0; i < 8; i++ {
+		key, value := fmt.Sprintf("big%d", i), strings.Repeat(fmt.Sprint(i), 512*1024)
+		b.Put([]byte(key), []byte(value))
+		expected[key] = value
+	}
+	assert.Greater(t, int64(8*512*1024), primary.maxFrameSize())
+	assert.Nil(t, primary.Write(b))
+	assert.Nil(t, primary.Set([]byte("after"), []byte("v")))
+	expected["after"] = "v"
+
+	waitInSync(t, primary, replica)
+	assertReplicated(t, replica, expected)
+	replica.mu.Lock()
+	fullSyncs := replica.replica.fullSyncs
+	replica.mu.Unlock()
+	assert.Equal(t, 1, fullSyncs, "Expected the batch to be streamed rather than sent by a full sync")
+}
@@ -0,0 +1,358 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Panda-Home/bitcask/data"
+	"github.com/Panda-Home/bitcask/utils"
+)
+
+const (
+	// defaultScanLimit is the page size of range command when not given
+	defaultScanLimit = 1000
+	// defaultScanCount is the number of keys scan command visits per
+	// call when not given
+	defaultScanCount = 10
+)
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// KeyValue is one item of a scan result. Value is only set
+// when values are requested.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Range returns at most limit keys in [start, end) in lexicographic
+// order. An empty end means no upper bound. The returned next key is
+// where the following page starts, it's nil once all keys are returned.
+func (s *Server) Range(start, end []byte, limit int, withValues bool) ([]KeyValue, []byte, error) {
+	if limit <= 0 {
+		return nil, nil, errors.New("Limit must be positive integer")
+	}
+	return s.ascend(start, limit, withValues, func(key []byte) (bool, bool) {
+		inRange := len(end) == 0 || bytes.Compare(key, end) < 0
+		return inRange, inRange
+	})
+}
+
+// Scan returns at most limit keys with given prefix in lexicographic
+// order, starting from start when it's not empty. The returned next
+// key is where the following page starts, it's nil once all keys are
+// returned.
+func (s *Server) Scan(prefix, start []byte, limit int, withValues bool) ([]KeyValue, []byte, error) {
+	if limit <= 0 {
+		return nil, nil, errors.New("Limit must be positive integer")
+	}
+	if bytes.Compare(start, prefix) < 0 {
+		start = prefix
+	}
+	return s.ascend(start, limit, withValues, func(key []byte) (bool, bool) {
+		inRange := bytes.HasPrefix(key, prefix)
+		return inRange, inRange
+	})
+}
+
+// ScanMatch visits at most count keys from cursor in lexicographic
+// order and returns those matching the glob pattern, an empty pattern
+// matches every key. The returned cursor is where the following call
+// continues, it's nil once all keys are visited. Since KeyDir is only
+// locked for the visited keys, keys added or deleted between calls
+// may or may not be returned.
+func (s *Server) ScanMatch(cursor []byte, pattern string, count int, withValues bool) ([]KeyValue, []byte, error) {
+	if count <= 0 {
+		return nil, nil, errors.New("Count must be positive integer")
+	}
+	// Every matching key starts with the literal prefix of pattern,
+	// so the walk can start right there and stop after it.
+	prefix := []byte(utils.GlobPrefix(pattern))
+	start := cursor
+	if bytes.Compare(start, prefix) < 0 {
+		start = prefix
+	}
+	return s.ascend(start, count, withValues, func(key []byte) (bool, bool) {
+		if !bytes.HasPrefix(key, prefix) {
+			return false, false
+		}
+		return pattern == "" || utils.GlobMatch(pattern, string(key)), true
+	})
+}
+
+// Keys returns all keys matching the glob pattern in lexicographic
+// order. KeyDir is walked in chunks so other commands aren't blocked
+// for the whole traversal.
+func (s *Server) Keys(pattern string) ([][]byte, error) {
+	var (
+		keys   [][]byte
+		cursor []byte
+	)
+	for {
+		kvs, next, err := s.ScanMatch(cursor, pattern, defaultScanLimit, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		if next == nil {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
+
+// ascend walks at most limit keys from start in lexicographic order.
+// visit tells if a key is part of the result and if the walk should go
+// on, the walk is over once it returns false for the latter. The key
+// left when limit is reached is returned as the next cursor, it's nil
+// when the walk is over.
+func (s *Server) ascend(start []byte, limit int, withValues bool, visit func(key []byte) (selected bool, more bool)) ([]KeyValue, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		result  []KeyValue
+		entries []*data.KeyDirEntry
+		next    []byte
+		visited int
+	)
+	s.keyDir.Ascend(start, func(key []byte, entry *data.KeyDirEntry) bool {
+		selected, more := visit(key)
+		if !more {
+			return false
+		}
+		if visited == limit {
+			next = key
+			return false
+		}
+		visited++
+		if !selected {
+			return true
+		}
+		result = append(result, KeyValue{Key: key})
+		entries = append(entries, entry)
+		return true
+	})
+
+	if withValues {
+		values, err := s.readValues(entries)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range result {
+			result[i].Value = values[i]
+		}
+	}
+	return result, next, nil
+}
+
+// scanOptions are the optional arguments of range and prefixscan:
+// [limit] [withvalues] [cursor <cursor>]
+type scanOptions struct {
+	limit      int
+	withValues bool
+	cursor     []byte
+}
+
+func parseRangeOptions(args []string) (*scanOptions, error) {
+	opts := &scanOptions{limit: defaultScanLimit}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "withvalues":
+			opts.withValues = true
+		case "cursor":
+			if i+1 >= len(args) {
+				return nil, errTooFewArgs
+			}
+			i++
+			cursor, err := hex.DecodeString(args[i])
+			if err != nil || len(cursor) == 0 {
+				return nil, errInvalidCursor
+			}
+			opts.cursor = cursor
+		default:
+			if i != 0 {
+				return nil, fmt.Errorf("Unknown option: %s", args[i])
+			}
+			limit, err := strconv.Atoi(args[i])
+			if err != nil {
+				return nil, fmt.Errorf("Not a valid integer: %s", args[i])
+			}
+			opts.limit = limit
+		}
+	}
+	return opts, nil
+}
+
+// formatScanResult renders the cursor of the next page, "0" when
+// there's none, followed by keys or key value pairs.
+func formatScanResult(kvs []KeyValue, next []byte, withValues bool) []byte {
+	lines := make([][]byte, 0, 1+2*len(kvs))
+	if next == nil {
+		lines = append(lines, []byte("0"))
+	} else {
+		lines = append(lines, []byte(hex.EncodeToString(next)))
+	}
+	for _, kv := range kvs {
+		lines = append(lines, kv.Key)
+		if withValues {
+			lines = append(lines, kv.Value)
+		}
+	}
+	return formatList(lines)
+}
+
+// scanArgs are the arguments of scan:
+// <cursor> [match <pattern>] [count <n>] [withvalues]
+type scanArgs struct {
+	cursor     []byte
+	pattern    string
+	count      int
+	withValues bool
+}
+
+// parseScanArgs parses a scan command. It's used both to run it and
+// to authorize it, so that the pattern checked is the one used.
+func parseScanArgs(tokens []string) (*scanArgs, error) {
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	args := &scanArgs{count: defaultScanCount}
+	if tokens[1] != "0" {
+		c, err := hex.DecodeString(tokens[1])
+		if err != nil || len(c) == 0 {
+			return nil, errInvalidCursor
+		}
+		args.cursor = c
+	}
+
+	seen := make(map[string]bool)
+	opts := tokens[2:]
+	for i := 0; i < len(opts); i++ {
+		if seen[opts[i]] {
+			return nil, fmt.Errorf("Duplicate option: %s", opts[i])
+		}
+		seen[opts[i]] = true
+		switch opts[i] {
+		case "withvalues":
+			args.withValues = true
+		case "match", "count":
+			if i+1 >= len(opts) {
+				return nil, errTooFewArgs
+			}
+			if opts[i] == "match" {
+				args.pattern = opts[i+1]
+			} else {
+				n, err := strconv.Atoi(opts[i+1])
+				if err != nil {
+					return nil, fmt.Errorf("Not a valid integer: %s", opts[i+1])
+				}
+				args.count = n
+			}
+			i++
+		default:
+			return nil, fmt.Errorf("Unknown option: %s", opts[i])
+		}
+	}
+	return args, nil
+}
+
+// processScanCommand handles:
+// scan <cursor> [match <pattern>] [count <n>] [withvalues]
+func (s *Server) processScanCommand(tokens []string) ([]byte, error) {
+	args, err := parseScanArgs(tokens)
+	if err != nil {
+		return nil, err
+	}
+	kvs, next, err := s.ScanMatch(args.cursor, args.pattern, args.count, args.withValues)
+	if err != nil {
+		return nil, err
+	}
+	return formatScanResult(kvs, next, args.withValues), nil
+}
+
+func (s *Server) processKeysCommand(tokens []string) ([]byte, error) {
+	if len(tokens) > 2 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	keys, err := s.Keys(tokens[1])
+	if err != nil {
+		return nil, err
+	}
+	return formatList(keys), nil
+}
+
+func (s *Server) processRangeCommand(tokens []string) ([]byte, error) {
+	if len(tokens) < 3 {
+		return nil, errTooFewArgs
+	}
+	opts, err := parseRangeOptions(tokens[3:])
+	if err != nil {
+		return nil, err
+	}
+	start := []byte(tokens[1])
+	if opts.cursor != nil {
+		if bytes.Compare(opts.cursor, start) < 0 {
+			return nil, errInvalidCursor
+		}
+		start = opts.cursor
+	}
+	kvs, next, err := s.Range(start, []byte(tokens[2]), opts.limit, opts.withValues)
+	if err != nil {
+		return nil, err
+	}
+	return formatScanResult(kvs, next, opts.withValues), nil
+}
+
+// processPrefixScanCommand handles:
+// prefixscan <prefix> [limit] [withvalues] [cursor <cursor>]
+func (s *Server) processPrefixScanCommand(tokens []string) ([]byte, error) {
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	opts, err := parseRangeOptions(tokens[2:])
+	if err != nil {
+		return nil, err
+	}
+	prefix := []byte(tokens[1])
+	if opts.cursor != nil && !bytes.HasPrefix(opts.cursor, prefix) {
+		return nil, errInvalidCursor
+	}
+	kvs, next, err := s.Scan(prefix, opts.cursor, opts.limit, opts.withValues)
+	if err != nil {
+		return nil, err
+	}
+	return formatScanResult(kvs, next, opts.withValues), nil
+}
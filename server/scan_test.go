@@ -0,0 +1,141 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newScanTestServer(t *testing.T) (*Server, func()) {
+	s, cleanup := newTestServer(t)
+	for _, key := range []string{"user:3", "user:1", "user:2", "order:1", "user", "users", "zeta"} {
+		if err := s.Set([]byte(key), []byte("v-"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, cleanup
+}
+
+func kvKeys(kvs []KeyValue) []string {
+	var keys []string
+	for _, kv := range kvs {
+		keys = append(keys, string(kv.Key))
+	}
+	return keys
+}
+
+func Test_Range(t *testing.T) {
+	s, cleanup := newScanTestServer(t)
+	defer cleanup()
+
+	kvs, next, err := s.Range([]byte("user"), []byte("user:3"), 10, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user", "user:1", "user:2"}, kvKeys(kvs), "Expected end to be excluded")
+	assert.Nil(t, next)
+
+	kvs, next, err = s.Range([]byte("o"), nil, 2, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"order:1", "user"}, kvKeys(kvs))
+	assert.Equal(t, "v-order:1", string(kvs[0].Value))
+	assert.Equal(t, "user:1", string(next))
+	kvs, next, err = s.Range(next, nil, 10, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2", "user:3", "users", "zeta"}, kvKeys(kvs))
+	assert.Nil(t, next)
+
+	_, _, err = s.Range(nil, nil, 0, false)
+	assert.Error(t, err)
+}
+
+func Test_Scan(t *testing.T) {
+	s, cleanup := newScanTestServer(t)
+	defer cleanup()
+
+	kvs, next, err := s.Scan([]byte("user:"), nil, 2, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2"}, kvKeys(kvs))
+	assert.Equal(t, "v-user:2", string(kvs[1].Value))
+	kvs, next, err = s.Scan([]byte("user:"), next, 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:3"}, kvKeys(kvs))
+	assert.Nil(t, next, "Expected the scan to stop after the prefix")
+
+	kvs, next, err = s.ScanMatch(nil, "user:[12]", 10, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2"}, kvKeys(kvs))
+	assert.Nil(t, next)
+	kvs, next, err = s.ScanMatch(nil, "*:1", 3, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"order:1", "user:1"}, kvKeys(kvs), "Expected visited keys which don't match to be skipped")
+	assert.Equal(t, "user:2", string(next))
+
+	keys, err := s.Keys("user*")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("user"), []byte("user:1"), []byte("user:2"), []byte("user:3"), []byte("users")}, keys)
+	keys, err = s.Keys("missing*")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func Test_ScanCommands(t *testing.T) {
+	s, cleanup := newScanTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	cursor := hex.EncodeToString([]byte("user:3"))
+	replies := roundTrip(t, conn, r,
+		"prefixscan user: 2",
+		"prefixscan user: 2 withvalues cursor "+cursor,
+		"prefixscan user: cursor "+hex.EncodeToString([]byte("zeta")),
+		"range user users",
+		"range a z 1 cursor "+cursor,
+		"scan 0 match user:* count 3",
+		"scan "+cursor+" match user:*",
+		"scan zz",
+		"scan 0 match user:* match *",
+		"keys *:1",
+		"range a",
+	)
+	assert.Equal(t, []string{
+		strings.Join([]string{cursor, "user:1", "user:2"}, "\n"),
+		strings.Join([]string{"0", "user:3", "v-user:3"}, "\n"),
+		errInvalidCursor.Error(),
+		strings.Join([]string{"0", "user", "user:1", "user:2", "user:3"}, "\n"),
+		strings.Join([]string{hex.EncodeToString([]byte("users")), "user:3"}, "\n"),
+		strings.Join([]string{"0", "user:1", "user:2", "user:3"}, "\n"),
+		strings.Join([]string{"0", "user:3"}, "\n"),
+		errInvalidCursor.Error(),
+		"Duplicate option: match",
+		"order:1\nuser:1",
+		errTooFewArgs.Error(),
+	}, replies)
+}
@@ -25,21 +25,27 @@ package server
 // SOFTWARE.
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Panda-Home/bitcask/bitlog"
 	"github.com/Panda-Home/bitcask/config"
 	"github.com/Panda-Home/bitcask/data"
+	"github.com/Panda-Home/bitcask/logging"
 	"github.com/Panda-Home/bitcask/utils"
 )
 
@@ -48,86 +54,339 @@ var (
 	errUnknownCommand = errors.New("Unknown command")
 	errTooManyArgs    = errors.New("Too many arguments")
 	errTooFewArgs     = errors.New("Too few arguments")
+	errLoading        = errors.New("Server is loading data")
+	errShuttingDown   = errors.New("Server is shutting down")
+
+	// ErrReadOnly is returned by writes when the server is read-only
+	ErrReadOnly = errors.New("Server is read-only")
+
+	// ErrValueTooLarge is returned when a value is larger than
+	// max_value_size_in_bytes
+	ErrValueTooLarge = errors.New("Value is too large")
 )
 
+// lockFileName is the lock file held in the data directory
+const lockFileName = "bitcask.lock"
+
 // Server represents the tcp server handling all incoming requests
 // with Bitcask operations
 type Server struct {
-	listener net.Listener
-	running  bool
-	quit     chan interface{}
-	logFile  *bitlog.Logger
-	keyDir   *data.KeyDir
+	listeners  []net.Listener
+	unixSocket string // removed on Stop
+	httpServer *http.Server
+	running    bool
+	quit       chan interface{}
+	dataDir    string
+	logFile    *bitlog.Logger // nil when read-only
+	readOnly   bool
+	lock       *utils.FileLock // held on the data directory, shared when read-only
+	keyDir     *data.KeyDir
+	ready      int32  // set atomically, 1 once KeyDir is rebuilt
+	version    uint64 // last version given to a write, guarded by mu
+	slowLog    *slowLog
+
+	maxValueSize int64
+	codec        data.Codec       // nil when values aren't compressed
+	compressMin  int              // values smaller than that aren't compressed
+	keyring      *data.Keyring    // nil when values aren't encrypted
+	users        map[string]*user // nil when authentication is disabled
+
+	backlog  *replBacklog              // guarded by mu
+	replicas map[*replicaInfo]struct{} // guarded by mu
+	replica  *replica                  // nil unless replicating from a primary
+
+	clients      *clientRegistry
+	maxClients   int
+	idleTimeout  time.Duration // no read deadline when 0
+	writeTimeout time.Duration // no write deadline when 0
+	gracePeriod  time.Duration // for commands in flight on shutdown
+	shutdown     sync.Once
 
 	mu sync.Mutex
 	wg sync.WaitGroup
 }
 
+// client is the state of one connection
+type client struct {
+	id          uint64
+	conn        net.Conn
+	addr        string
+	connectedAt time.Time
+	killed      int32 // set atomically by client kill
+	busy        int32 // set atomically while a command runs
+
+	mu         sync.Mutex // guards the fields read by client list
+	lastActive time.Time
+	lastCmd    string
+	userName   string
+
+	r       *bufio.Reader
+	w       *bufio.Writer // replies are flushed once pending commands are run
+	replied bool          // set when a command sent its own reply
+	closing bool          // set when the connection can't be read from anymore
+	batch   *WriteBatch   // commands queued between batch begin and commit
+	txn     *Txn          // keys watched and commands queued after multi
+	multi   bool          // set between multi and exec or discard
+	user    *user         // set once authenticated
+	body    io.Reader     // value sent along with setstream
+}
+
 // NewServer ...
 func NewServer(c *config.BitcaskConfig) (*Server, error) {
 	addr := fmt.Sprintf("%s:%d", c.Host, c.Port)
 	s := &Server{
-		quit: make(chan interface{}),
+		dataDir:      c.DataDir,
+		readOnly:     c.ReadOnly,
+		replicas:     make(map[*replicaInfo]struct{}),
+		quit:         make(chan interface{}),
+		slowLog:      newSlowLog(time.Duration(c.SlowlogThreshold)*time.Microsecond, c.SlowlogMaxLen),
+		maxValueSize: c.MaxValueSize,
+		compressMin:  c.CompressionThreshold,
+		clients:      newClientRegistry(),
+		maxClients:   c.MaxClients,
+		idleTimeout:  time.Duration(c.IdleTimeout) * time.Second,
 	}
-	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
-	if err != nil {
-		return nil, fmt.Errorf("Cannot resolve address: %s", addr)
+	if s.maxValueSize == 0 {
+		// configs not loaded by config.NewBitcaskConfig have no default
+		s.maxValueSize = config.DefaultMaxValueSize
+	}
+	if c.WriteTimeout > 0 {
+		s.writeTimeout = time.Duration(c.WriteTimeout) * time.Second
 	}
-	l, err := net.Listen("tcp", tcpAddr.String())
+	if c.ShutdownGracePeriod > 0 {
+		s.gracePeriod = time.Duration(c.ShutdownGracePeriod) * time.Second
+	}
+	codec, err := data.CodecByName(c.Compression)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	s.codec = codec
+	if s.keyring, err = data.LoadKeyring(c.EncryptionKeyFile, c.OldEncryptionKeyFiles); err != nil {
+		return nil, err
+	}
+	if s.users, err = newUsers(c.Users); err != nil {
+		return nil, err
+	}
+	if c.ReplicaOf != "" {
+		if c.ReadOnly {
+			return nil, errors.New("A replica can't be read-only, it's written to by its primary")
+		}
+		tlsConfig, err := newReplicaTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		s.replica = &replica{
+			primary:   c.ReplicaOf,
+			user:      c.ReplicaUser,
+			password:  c.ReplicaPassword,
+			tlsConfig: tlsConfig,
+			state:     "connecting",
+		}
+	}
+	if c.Port != 0 || c.UnixSocket == "" {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot resolve address: %s", addr)
+		}
+		l, err := net.Listen("tcp", tcpAddr.String())
+		if err != nil {
+			logging.Fatal("Failed to listen", "addr", addr, "err", err)
+		}
+		if c.TLSCertFile != "" {
+			reloader, err := newTLSReloader(c)
+			if err != nil {
+				l.Close()
+				return nil, err
+			}
+			l = tls.NewListener(l, reloader.serverConfig())
+		}
+		s.listeners = append(s.listeners, l)
+	}
+	if c.UnixSocket != "" {
+		l, err := listenUnix(c.UnixSocket, c.UnixSocketPermissions)
+		if err != nil {
+			s.closeListeners()
+			return nil, fmt.Errorf("Failed to listen on %s: %s", c.UnixSocket, err)
+		}
+		s.listeners = append(s.listeners, l)
+		s.unixSocket = c.UnixSocket
 	}
-	s.listener = l
 
 	s.keyDir = data.NewKeyDir() // in-memory structure initialization
-	logFile, err := bitlog.NewLogger(c.DataDir, c.DataSize, false)
-	if err != nil {
-		log.Fatal(err)
+	if s.lock, err = lockDataDir(c.DataDir, !c.ReadOnly); err != nil {
+		s.closeListeners()
+		return nil, err
+	}
+	if !c.ReadOnly {
+		logFile, err := bitlog.NewLogger(c.DataDir, c.DataSize, false)
+		if err != nil {
+			logging.Fatal("Failed to open data file", "dir", c.DataDir, "err", err)
+		}
+		s.logFile = logFile
 	}
-	s.logFile = logFile
-	s.loadExistingLog()
 
-	s.wg.Add(1)
-	log.Printf("Listening on %v\n", addr)
-	go s.serve()
+	// Health endpoints and the listener are up while KeyDir is being
+	// rebuilt, so that callers can tell a loading node from a dead one.
+	if c.HTTPPort != 0 {
+		if err := s.startHTTP(fmt.Sprintf("%s:%d", c.Host, c.HTTPPort)); err != nil {
+			logging.Fatal("Failed to start HTTP listener", "err", err)
+		}
+	}
+	s.running = true
+	for _, l := range s.listeners {
+		s.wg.Add(1)
+		logging.Info("Listening", "addr", l.Addr())
+		go s.serve(l)
+	}
+
+	if err := s.loadExistingLog(); err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("Failed to load data files: %s", err)
+	}
+	if !c.ReadOnly {
+		if err := checkWritable(c.DataDir); err != nil {
+			s.Stop()
+			return nil, err
+		}
+	}
+	s.backlog = newReplBacklog(c.ReplicationBacklog, s.version)
+	atomic.StoreInt32(&s.ready, 1)
+	logging.Info("Ready to accept commands", "read_only", s.IsReadOnly())
+	if s.replica != nil {
+		s.replica.offset = loadReplicaOffset(c.DataDir)
+		s.wg.Add(1)
+		go s.replicate()
+	}
 	return s, nil
 }
 
-// Stop ...
+// Stop shuts the server down and closes data files
 func (s *Server) Stop() {
-	close(s.quit)
-	s.listener.Close()
-	s.logFile.Close()
+	s.Shutdown()
+	if err := s.Close(); err != nil {
+		logging.Error("Failed to close data file", "err", err)
+	}
+}
+
+// Shutdown stops accepting connections and lets commands in flight
+// finish within the grace period, commands received meanwhile are
+// rejected. Connections still busy after it are closed.
+func (s *Server) Shutdown() {
+	s.shutdown.Do(func() {
+		atomic.StoreInt32(&s.ready, 0)
+		close(s.quit)
+		s.closeListeners()
+		s.clients.interrupt()
+
+		done := make(chan struct{})
+		go func() {
+			s.wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(s.gracePeriod):
+			logging.Warn("Closing connections still busy after grace period", "clients", s.clients.len())
+			s.clients.closeAll()
+			<-done
+		}
+	})
+}
+
+// Close flushes and closes the active data file. It's meant to be
+// called after Shutdown, once nothing writes anymore.
+func (s *Server) Close() error {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
 	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.running = false
-	s.mu.Unlock()
-	s.wg.Wait()
+	var err error
+	if s.logFile != nil {
+		err = s.logFile.Close()
+	}
+	if err == nil && s.replica != nil {
+		err = s.saveReplicaOffset()
+	}
+	if s.lock != nil {
+		s.lock.Unlock()
+	}
+	return err
+}
+
+// IsReadOnly tells if the server rejects writes, either opened
+// read-only or replicating from a primary
+func (s *Server) IsReadOnly() bool {
+	return s.readOnly || s.replica != nil
 }
 
-// UpdateKeyDir ...
-func (s *Server) UpdateKeyDir(key []byte, fileID string, valuePos int64, valueSize uint32, ts uint64) error {
+// lockDataDir makes sure no other process writes to dir, or uses it
+// at all when exclusive. A shared lock can't be taken without the lock
+// file, which is only created by writers, the directory is then used
+// unlocked and nil is returned.
+func lockDataDir(dir string, exclusive bool) (*utils.FileLock, error) {
+	path := filepath.Join(dir, lockFileName)
+	lock, err := utils.LockFile(path, exclusive)
+	if !exclusive && os.IsNotExist(err) {
+		logging.Warn("Data directory has no lock file, opening it unlocked", "dir", dir, "file", lockFileName)
+		return nil, nil
+	}
+	if err == utils.ErrLocked {
+		return nil, fmt.Errorf("Data directory %s is in use by another process (pid %d)", dir, utils.ReadPid(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock data directory: %s", err)
+	}
+	return lock, nil
+}
+
+func (s *Server) closeListeners() {
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	if s.unixSocket != "" {
+		os.Remove(s.unixSocket)
+	}
+}
+
+// UpdateKeyDir points key to its merged copy, unless the key has
+// been written or deleted since the merger read it.
+func (s *Server) UpdateKeyDir(key []byte, merged *data.KeyDirEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	value, err := s.keyDir.GetValue(key)
-	if value != nil {
-		fmt.Println("In record", value.FileID, value.Timestamp)
+	if err != nil {
+		// deleted after the merger read it
+		return nil
 	}
-	if err == nil && value.Timestamp > ts {
+	logging.Debug("Merged key in record", "file", value.FileID, "timestamp", value.Timestamp)
+	if value.Version != merged.Version || value.Timestamp > merged.Timestamp {
 		// no need to update since server has the latest version of value
 		return nil
 	}
-	if err := s.keyDir.SetEntryFromKeyValue(key, fileID, valuePos, valueSize, ts); err != nil {
-		return fmt.Errorf("Failed to update keydir: %s", err)
-	}
+	s.keyDir.SetEntry(key, merged)
 	return nil
 }
 
-// GetActiveFile ...
+// Keyring returns the encryption keys, nil when values aren't encrypted
+func (s *Server) Keyring() *data.Keyring {
+	return s.keyring
+}
+
+// GetActiveFile returns the path of the file written to, empty when
+// read-only
 func (s *Server) GetActiveFile() string {
+	if s.logFile == nil {
+		return ""
+	}
 	return s.logFile.ActiveFilepath()
 }
 
 // Build KeyDir structure from existing log files
 func (s *Server) loadExistingLog() error {
-	files, err := ioutil.ReadDir(s.logFile.Dirpath)
+	files, err := ioutil.ReadDir(s.dataDir)
 	if err != nil {
 		return err
 	}
@@ -141,97 +400,283 @@ func (s *Server) loadExistingLog() error {
 		if !strings.HasPrefix(f.Name(), "data.bit.") {
 			continue
 		}
-		filePath := filepath.Join(s.logFile.Dirpath, f.Name())
+		filePath := filepath.Join(s.dataDir, f.Name())
 		fileHandler, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
 		if err != nil {
-			log.Printf("Failed to open file: %s", filePath)
+			logging.Warn("Failed to open file", "file", filePath, "err", err)
 			continue
 		}
 
 		// Read each record from file to build KeyDir
-		var curPos int64 = 0
-		for {
-			entry, err := data.LoadFromFile(fileHandler, curPos)
-			if err != nil {
-				break
+		end, err := data.ReadEntries(fileHandler, func(entry *data.Entry, pos int64) error {
+			if entry.Version > s.version {
+				s.version = entry.Version
+			}
+			// Check keys up front rather than failing on each read
+			if entry.Flags&data.FlagEncrypted != 0 && (s.keyring == nil || !s.keyring.HasKey(entry.KeyID)) {
+				return fmt.Errorf("%s has values encrypted with key %08x, which isn't configured", filePath, entry.KeyID)
 			}
-			valueSize := entry.ValueSize
-			key := entry.Key
-			if valueSize > 0 {
-				// not a delete record
-				s.keyDir.SetEntryFromKeyValue(key, filePath, curPos, valueSize, entry.Timestamp)
+			if entry.IsTombstone() {
+				s.keyDir.DelKeydirEntry(entry.Key)
 			} else {
-				s.keyDir.DelKeydirEntry(key)
+				s.keyDir.SetEntry(entry.Key, data.NewKeyDirEntry(filePath, pos, entry))
+			}
+			return nil
+		})
+		if err == nil && end < f.Size() {
+			// Only an interrupted write may be dropped, entries after a
+			// corrupted one would be lost with it
+			if terr := data.CheckTail(fileHandler, end); terr != nil {
+				err = fmt.Errorf("Data file %s is corrupted: %s", filePath, terr)
 			}
-			curPos += int64(160 + entry.KeySize + valueSize)
 		}
 		fileHandler.Close()
+		if err != nil {
+			return err
+		}
+		if end == f.Size() {
+			continue
+		}
+
+		// New entries are appended to the active file, they'd be out
+		// of reach behind an incomplete write.
+		if filePath == s.GetActiveFile() {
+			logging.Warn("Dropping incomplete write at the end of data file",
+				"file", filePath, "size", f.Size(), "end", end)
+			if err := s.logFile.Truncate(end); err != nil {
+				return err
+			}
+		} else {
+			logging.Warn("Skipping incomplete write at the end of data file",
+				"file", filePath, "size", f.Size(), "end", end)
+		}
 	}
 	return nil
 }
 
-func (s *Server) serve() {
+func (s *Server) serve(l net.Listener) {
 	defer s.wg.Done()
 
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := l.Accept()
 		if err != nil {
 			select {
 			case <-s.quit:
 				return
 			default:
-				log.Println("accept error", err)
+				logging.Error("Accept error", "err", err)
 			}
-		} else {
-			s.wg.Add(1)
-			go func() {
-				s.handleConection(conn)
-				s.wg.Done()
-			}()
+			continue
+		}
+		c := newClient(conn)
+		if err := s.clients.add(c, s.maxClients); err != nil {
+			if err == errTooManyClients {
+				rejectedConnections.Inc()
+				logging.Warn("Rejecting connection", "client", c.addr, "err", err)
+			}
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			fmt.Fprintf(conn, "%d\n%s\n", len(err.Error()), err)
+			conn.Close()
+			continue
 		}
+		s.wg.Add(1)
+		go func() {
+			s.handleConection(c)
+			s.wg.Done()
+		}()
 	}
 }
 
-func (s *Server) handleConection(conn net.Conn) {
-	defer conn.Close()
-	buf := make([]byte, 4096)
-ReadLoop:
+func (s *Server) handleConection(c *client) {
+	conn := c.conn
+	defer func() {
+		conn.Close()
+		s.clients.remove(c)
+	}()
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// done up front so that it isn't cut by the read deadline
+		tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			logging.Warn("TLS handshake failed", "client", c.addr, "err", err)
+			return
+		}
+	}
+	conn.SetDeadline(time.Time{})
 	for {
+		// Replies are held back while more commands are buffered, so
+		// that pipelined commands get their replies in few writes.
+		if c.r.Buffered() == 0 {
+			if err := s.flush(c); err != nil {
+				return
+			}
+		}
+		// Reads block until a command comes in, client kill closes
+		// the connection to interrupt them. Shutdown sets a past
+		// deadline, which is checked for after setting this one so
+		// that it can't be overridden: only commands already buffered
+		// are read afterwards, and rejected.
+		if s.idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
 		select {
 		case <-s.quit:
-			return
+			conn.SetReadDeadline(time.Now())
 		default:
-			conn.SetDeadline(time.Now().Add(200 * time.Millisecond))
-			n, err := conn.Read(buf)
-			if err != nil {
-				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
-					continue ReadLoop
-				} else if err != io.EOF {
-					log.Println("read error", err)
-					return
-				}
-			}
-			if n == 0 {
+		}
+		cmd, err := readCommand(c.r)
+		if err != nil {
+			select {
+			case <-s.quit:
 				return
+			default:
 			}
-			log.Printf("received from %v: %s", conn.RemoteAddr(), string(buf[:n]))
-			result, err := s.processCommand(strings.TrimSpace(string(buf[:n])))
-			if err != nil {
-				conn.Write([]byte(err.Error()))
-			} else {
-				conn.Write(result)
+			if err == errCommandTooLong {
+				// the rest of the line can't be told from commands
+				writeReply(c.w, []byte(err.Error()))
+				s.flush(c)
+			} else if c.isKilled() {
+				logging.Info("Client killed", "client", c.addr)
+			} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				logging.Info("Closing idle connection", "client", c.addr)
+			} else if err != io.EOF {
+				logging.Error("Read error", "client", c.addr, "err", err)
+			}
+			return
+		}
+		if logging.Enabled(logging.LevelDebug) {
+			logging.Debug("Received command", "client", c.addr, "command", redactCommand(cmd))
+		}
+		result, err := s.execute(c, cmd)
+		if err != nil {
+			result = []byte(err.Error())
+		}
+		if c.replied {
+			c.replied = false
+		} else {
+			if s.writeTimeout > 0 {
+				conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+			}
+			if err := writeReply(c.w, result); err != nil {
+				logging.Warn("Write error", "client", c.addr, "err", err)
+				return
 			}
-
+		}
+		if c.closing {
+			s.flush(c)
+			return
 		}
 	}
 }
 
-func (s *Server) processCommand(cmd string) ([]byte, error) {
-	if len(cmd) == 0 {
-		return nil, errEmptyCommand
+// flush sends the replies buffered for c
+func (s *Server) flush(c *client) error {
+	if s.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
 	}
+	err := c.w.Flush()
+	if err != nil {
+		logging.Warn("Write error", "client", c.addr, "err", err)
+	}
+	return err
+}
+
+// execute runs cmd sent by client and keeps track of its latency
+func (s *Server) execute(c *client, cmd string) ([]byte, error) {
 	tokens := strings.Fields(cmd)
+	if len(tokens) == 0 {
+		return nil, errEmptyCommand
+	}
+
+	c.begin(tokens[0])
+	start := time.Now()
+	if tokens[0] == "setstream" {
+		c.body = newChunkedReader(streamConn{c})
+	}
+	result, err := s.processCommand(c, tokens)
+	elapsed := time.Since(start)
+	if c.body != nil {
+		c.skipBody(err)
+	}
+	c.end()
+	observeRequest(tokens[0], err, elapsed)
+	if !streamingCommands[tokens[0]] {
+		s.slowLog.record(c.addr, tokens, elapsed)
+	}
+	return result, err
+}
+
+// skipBody reads what's left of the value sent along with a streaming
+// command, which is all of it when the command was rejected before
+// running, so that it isn't taken for commands. The connection is
+// closed instead when the server is stopping, or when the value can't
+// be parsed.
+func (c *client) skipBody(err error) {
+	if err == errShuttingDown {
+		c.closing = true
+	} else if _, derr := io.Copy(ioutil.Discard, c.body); derr != nil {
+		c.closing = true
+	}
+	c.body = nil
+}
+
+// streamingCommands last as long as data flows through them, so their
+// duration tells nothing about latency
+var streamingCommands = map[string]bool{
+	"setstream": true,
+	"getstream": true,
+	"sync":      true,
+	"subscribe": true,
+}
+
+func (s *Server) processCommand(c *client, tokens []string) ([]byte, error) {
+	if !s.IsReady() {
+		select {
+		case <-s.quit:
+			return nil, errShuttingDown
+		default:
+			return nil, errLoading
+		}
+	}
+
+	// Checked before queueing, so that queued writes are allowed
+	if err := s.authorize(c, tokens); err != nil {
+		return nil, err
+	}
+	if s.IsReadOnly() && commandACLs[tokens[0]].category == categoryWrite {
+		return nil, ErrReadOnly
+	}
+
+	if tokens[0] == "set" || tokens[0] == "del" {
+		if c.batch != nil {
+			return queueBatchCommand(c.batch, tokens)
+		}
+		if c.multi {
+			return queueBatchCommand(c.txn.batch, tokens)
+		}
+	}
+	// Other writes would bypass the batch or transaction
+	if (c.batch != nil || c.multi) && !isQueueControl(tokens[0]) && commandACLs[tokens[0]].category == categoryWrite {
+		return nil, errNotQueueable
+	}
+
 	switch tokens[0] {
+	case "auth":
+		return s.processAuthCommand(c, tokens)
+	case "client":
+		return s.processClientCommand(c, tokens)
+	case "sync":
+		return s.processSyncCommand(c, tokens)
+	case "replication":
+		return s.processReplicationCommand(tokens)
+	case "subscribe":
+		return s.processSubscribeCommand(c, tokens)
+	case "ping":
+		if len(tokens) > 1 {
+			return nil, errTooManyArgs
+		}
+		return []byte("PONG"), nil
 	case "set":
 		if len(tokens) > 3 {
 			return nil, errTooManyArgs
@@ -267,14 +712,113 @@ func (s *Server) processCommand(cmd string) ([]byte, error) {
 			return nil, err
 		}
 		return []byte("OK"), nil
+	case "mget":
+		if len(tokens) < 2 {
+			return nil, errTooFewArgs
+		}
+		values, err := s.MGet(toKeys(tokens[1:]))
+		if err != nil {
+			return nil, err
+		}
+		// Values can't be empty, an empty frame is a missing key
+		return formatFrames(values), nil
+	case "exists":
+		if len(tokens) < 2 {
+			return nil, errTooFewArgs
+		}
+		return []byte(strconv.Itoa(s.Exists(toKeys(tokens[1:])))), nil
+	case "strlen":
+		if len(tokens) > 2 {
+			return nil, errTooManyArgs
+		}
+		if len(tokens) < 2 {
+			return nil, errTooFewArgs
+		}
+		return []byte(strconv.Itoa(s.StrLen([]byte(tokens[1])))), nil
+	case "slowlog":
+		return s.processSlowLogCommand(tokens)
+	case "scan":
+		return s.processScanCommand(tokens)
+	case "range":
+		return s.processRangeCommand(tokens)
+	case "prefixscan":
+		return s.processPrefixScanCommand(tokens)
+	case "keys":
+		return s.processKeysCommand(tokens)
+	case "mset":
+		return s.processMSetCommand(tokens)
+	case "batch":
+		return s.processBatchCommand(c, tokens)
+	case "watch", "unwatch", "multi", "exec", "discard":
+		return s.processTxnCommand(c, tokens)
+	case "incr", "decr", "incrby", "incrbyfloat":
+		return s.processCounterCommand(tokens)
+	case "setstream":
+		return s.processSetStreamCommand(c, tokens)
+	case "getstream":
+		return s.processGetStreamCommand(c, tokens)
+	case "append":
+		return s.processAppendCommand(tokens)
+	case "getrange":
+		return s.processGetRangeCommand(tokens)
+	case "setrange":
+		return s.processSetRangeCommand(tokens)
+	case "setnx", "setxx", "cas":
+		return s.processConditionalSetCommand(tokens)
+	case "getv":
+		return s.processGetVCommand(tokens)
 	default:
 		return nil, errUnknownCommand
 	}
 }
 
+func toKeys(tokens []string) [][]byte {
+	keys := make([][]byte, len(tokens))
+	for i, token := range tokens {
+		keys[i] = []byte(token)
+	}
+	return keys
+}
+
+// formatList renders a reply made of several items, one per line
+func formatList(items [][]byte) []byte {
+	return bytes.Join(items, []byte("\n"))
+}
+
+// IsReady tells if the server has rebuilt KeyDir from data files and
+// is able to serve commands. It turns false as soon as Stop is called.
+func (s *Server) IsReady() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
 // IsRunning returns the server running status
 func (s *Server) IsRunning() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.running
 }
+
+// checkWritable makes sure new data files can be created in dir
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".writable-")
+	if err != nil {
+		return fmt.Errorf("Data directory is not writable: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write([]byte("ok")); err != nil {
+		return fmt.Errorf("Data directory is not writable: %s", err)
+	}
+	return nil
+}
+
+// redactCommand keeps the command name and key of cmd for logging,
+// the remaining arguments may carry values and are masked.
+func redactCommand(cmd string) string {
+	tokens := strings.Fields(cmd)
+	for i := 2; i < len(tokens); i++ {
+		tokens[i] = fmt.Sprintf("<redacted %d bytes>", len(tokens[i]))
+	}
+	return strings.Join(tokens, " ")
+}
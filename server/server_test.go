@@ -0,0 +1,467 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/Panda-Home/bitcask/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "bitcask-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(&config.BitcaskConfig{
+		Host:                 "127.0.0.1",
+		DataDir:              dir,
+		DataSize:             1,
+		SlowlogThreshold:     10000,
+		SlowlogMaxLen:        128,
+		MaxValueSize:         1 << 20,
+		CompressionThreshold: 1024,
+		WriteTimeout:         30,
+		ShutdownGracePeriod:  10,
+		ReplicationBacklog:   100,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_DataDirLock(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	_, err := NewServer(&config.BitcaskConfig{Host: "127.0.0.1", DataDir: s.dataDir, DataSize: 1})
+	assert.EqualError(t, err, fmt.Sprintf("Data directory %s is in use by another process (pid %d)", s.dataDir, os.Getpid()))
+}
+
+func Test_CorruptedDataFile(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	for _, key := range []string{"k1", "k2", "k3"} {
+		assert.Nil(t, s.Set([]byte(key), []byte("value")))
+	}
+	activeFile := s.GetActiveFile()
+	s.Stop()
+	c := &config.BitcaskConfig{Host: "127.0.0.1", DataDir: s.dataDir, DataSize: 1}
+
+	// A write cut short is dropped
+	contents, _ := ioutil.ReadFile(activeFile)
+	entrySize := len(contents) / 3
+	assert.Nil(t, ioutil.WriteFile(activeFile, contents[:len(contents)-10], 0644))
+	reopened, err := NewServer(c)
+	assert.Nil(t, err)
+	_, err = reopened.Get([]byte("k3"))
+	assert.Error(t, err)
+	assert.Equal(t, int64(2*entrySize), reopened.logFile.ActiveFilePos(), "Expected the incomplete write to be truncated")
+	reopened.Stop()
+
+	// A corrupted entry followed by valid ones stops the server rather
+	// than losing them
+	contents[entrySize+data.HeaderSize] ^= 0xff
+	assert.Nil(t, ioutil.WriteFile(activeFile, contents, 0644))
+	_, err = NewServer(c)
+	assert.EqualError(t, err, fmt.Sprintf("Failed to load data files: Data file %s is corrupted: Broken entry at offset %d", activeFile, entrySize))
+	info, _ := os.Stat(activeFile)
+	assert.Equal(t, int64(len(contents)), info.Size(), "Expected the data file to be left as is")
+}
+
+func Test_ReadOnly(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	assert.Nil(t, s.Set([]byte("foo"), []byte("bar")))
+	s.Stop()
+	files, _ := ioutil.ReadDir(s.dataDir)
+
+	c := &config.BitcaskConfig{Host: "127.0.0.1", DataDir: s.dataDir, DataSize: 1, ReadOnly: true}
+	ro, err := NewServer(c)
+	assert.Nil(t, err)
+	defer ro.Stop()
+	other, err := NewServer(c)
+	assert.Nil(t, err, "Expected read-only servers to share the data directory")
+	defer other.Stop()
+	assert.True(t, ro.IsReadOnly())
+
+	value, err := ro.Get([]byte("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", string(value))
+	assert.Equal(t, ErrReadOnly, ro.Set([]byte("foo"), []byte("baz")))
+	assert.Equal(t, ErrReadOnly, ro.Del([]byte("foo")))
+	_, err = ro.SetStream([]byte("foo"), strings.NewReader("baz"))
+	assert.Equal(t, ErrReadOnly, err)
+	b := NewWriteBatch()
+	b.Put([]byte("foo"), []byte("baz"))
+	assert.Equal(t, ErrReadOnly, ro.Write(b))
+	_, err = ro.processCommand(&client{}, []string{"incr", "counter"})
+	assert.Equal(t, ErrReadOnly, err)
+
+	after, _ := ioutil.ReadDir(s.dataDir)
+	assert.Equal(t, len(files), len(after), "Expected no file to be created")
+
+	c.ReadOnly = false
+	_, err = NewServer(c)
+	assert.Error(t, err, "Expected writers to be locked out by readers")
+}
+
+func Test_ReadOnlyWithoutLockFile(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	assert.Nil(t, s.Set([]byte("foo"), []byte("bar")))
+	s.Stop()
+	// as in a copy of the data files
+	assert.Nil(t, os.Remove(filepath.Join(s.dataDir, lockFileName)))
+	files, _ := ioutil.ReadDir(s.dataDir)
+
+	ro, err := NewServer(&config.BitcaskConfig{Host: "127.0.0.1", DataDir: s.dataDir, DataSize: 1, ReadOnly: true})
+	assert.Nil(t, err)
+	value, err := ro.Get([]byte("foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", string(value))
+	ro.Stop()
+
+	after, _ := ioutil.ReadDir(s.dataDir)
+	assert.Equal(t, len(files), len(after), "Expected no lock file to be created")
+}
+
+func dialTestServer(t *testing.T, s *Server) *net.TCPConn {
+	conn, err := net.Dial("tcp", s.listeners[0].Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	return conn.(*net.TCPConn)
+}
+
+func readReply(r *bufio.Reader) (string, error) {
+	reply, err := readFrame(r, 1<<30)
+	return string(reply), err
+}
+
+func Test_Pipeline(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+
+	const n = 5000
+	go func() {
+		w := bufio.NewWriter(conn)
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(w, "set key%d value%d\nget key%d\n", i, i, i)
+		}
+		w.WriteString("mget key0 key1\r\n")
+		w.Flush()
+	}()
+
+	r := bufio.NewReader(conn)
+	for i := 0; i < n; i++ {
+		reply, err := readReply(r)
+		assert.Nil(t, err)
+		assert.Equal(t, "OK", reply)
+		reply, err = readReply(r)
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("value%d", i), reply)
+	}
+	reply, err := readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "6\nvalue0\n6\nvalue1\n", reply)
+}
+
+// roundTrip sends each command and returns its reply
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, cmds ...string) []string {
+	var replies []string
+	for _, cmd := range cmds {
+		if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := readReply(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+func Test_PipelineErrors(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+
+	// Errors are replied in order without breaking the pipeline
+	conn.Write([]byte("get missing\n\nbogus\nset\nping\n"))
+	r := bufio.NewReader(conn)
+	for _, expected := range []string{"Key not found: missing", errUnknownCommand.Error(), errTooFewArgs.Error(), "PONG"} {
+		reply, err := readReply(r)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, reply)
+	}
+}
+
+func Test_CommandSplitAcrossWrites(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+
+	for _, part := range []string{"se", "t foo ", "bar\nget", " foo\n"} {
+		conn.Write([]byte(part))
+		time.Sleep(10 * time.Millisecond)
+	}
+	r := bufio.NewReader(conn)
+	reply, err := readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", reply)
+	reply, err = readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", reply)
+}
+
+func Test_LastCommandWithoutLineBreak(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+
+	conn.Write([]byte("ping"))
+	conn.CloseWrite()
+	r := bufio.NewReader(conn)
+	reply, err := readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", reply)
+	_, err = r.ReadByte()
+	assert.Equal(t, io.EOF, err, "Expected the connection to be closed")
+}
+
+func Test_PipelineStream(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+
+	conn.Write([]byte("setstream big\n5\nhello\n6\n world\n0\nget big\ngetstream big\nping\n"))
+	r := bufio.NewReader(conn)
+	reply, err := readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", reply)
+	reply, err = readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", reply)
+
+	value, err := ioutil.ReadAll(newChunkedReader(r))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(value))
+	reply, err = readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", reply)
+}
+
+func Test_CommandTooLong(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+
+	go conn.Write([]byte("set foo " + strings.Repeat("a", maxCommandSize) + "\n"))
+	r := bufio.NewReader(conn)
+	reply, err := readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, errCommandTooLong.Error(), reply)
+}
+
+func Test_Shutdown(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	idle := dialTestServer(t, s)
+	defer idle.Close()
+	busy := dialTestServer(t, s)
+	defer busy.Close()
+
+	// Wait for the connections to be registered
+	idle.Write([]byte("ping\n"))
+	busy.Write([]byte("setstream foo\n5\nhello\n"))
+	idleReader := bufio.NewReader(idle)
+	readReply(idleReader)
+	for !strings.Contains(string(clientList(t, s)), "cmd=setstream") {
+		time.Sleep(time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Shutdown()
+		close(stopped)
+	}()
+
+	// Idle connections are closed right away
+	_, err := idleReader.ReadByte()
+	assert.Equal(t, io.EOF, err, "Expected the idle connection to be closed")
+	select {
+	case <-stopped:
+		t.Fatal("Expected shutdown to wait for the streamed value")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The command in flight completes, the next one is rejected
+	busy.Write([]byte("0\nget foo\n"))
+	r := bufio.NewReader(busy)
+	reply, err := readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", reply)
+	reply, err = readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, errShuttingDown.Error(), reply)
+	<-stopped
+
+	_, err = net.Dial("tcp", s.listeners[0].Addr().String())
+	assert.Error(t, err, "Expected new connections to be refused")
+}
+
+func clientList(t *testing.T, s *Server) []byte {
+	list, err := s.processClientCommand(&client{}, []string{"client", "list"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// rejectedStream sends cmd along with a value holding a command, and
+// checks it's rejected with reply without the value being run
+func rejectedStream(t *testing.T, s *Server, conn net.Conn, r *bufio.Reader, cmd, reply string) {
+	conn.Write([]byte(cmd + "\n9\nset x yyy\n0\nping\n"))
+	got, err := readReply(r)
+	assert.Nil(t, err, cmd)
+	assert.Equal(t, reply, got, cmd)
+	got, err = readReply(r)
+	assert.Nil(t, err, cmd)
+	assert.Equal(t, "PONG", got, "Expected the value of %s to be skipped", cmd)
+	_, err = s.Get([]byte("x"))
+	assert.Error(t, err, "Expected the value of %s not to be run", cmd)
+}
+
+func Test_SetStreamRejected(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	rejectedStream(t, s, conn, r, "setstream", errTooFewArgs.Error())
+	rejectedStream(t, s, conn, r, "setstream a b", errTooManyArgs.Error())
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn, r, "batch begin"))
+	rejectedStream(t, s, conn, r, "setstream big", errNotQueueable.Error())
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn, r, "batch commit"))
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn, r, "multi"))
+	rejectedStream(t, s, conn, r, "setstream big", errNotQueueable.Error())
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn, r, "exec"))
+
+	// as while KeyDir is being rebuilt
+	atomic.StoreInt32(&s.ready, 0)
+	conn.Write([]byte("setstream big\n9\nset x yyy\n0\n"))
+	assert.Equal(t, errLoading.Error(), mustReadReply(t, r))
+	atomic.StoreInt32(&s.ready, 1)
+	assert.Equal(t, []string{"PONG", "Key not found: x"}, roundTrip(t, conn, r, "ping", "get x"), "Expected the value to be skipped")
+
+	// a value which can't be parsed can't be skipped either
+	conn.Write([]byte("batch begin\nsetstream big\nset x yyy\n"))
+	assert.Equal(t, "OK", mustReadReply(t, r))
+	assert.Equal(t, errNotQueueable.Error(), mustReadReply(t, r))
+	_, err := readReply(r)
+	assert.Equal(t, io.EOF, err, "Expected the connection to be closed")
+
+	s.Shutdown()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := newClient(server)
+	_, err = s.execute(c, "setstream big")
+	assert.Equal(t, errShuttingDown, err)
+	assert.True(t, c.closing, "Expected the connection to be closed rather than reading the value")
+}
+
+func Test_SetStreamRejectedReadOnly(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.Stop()
+	ro, err := NewServer(&config.BitcaskConfig{Host: "127.0.0.1", DataDir: s.dataDir, DataSize: 1, ReadOnly: true})
+	assert.Nil(t, err)
+	defer ro.Stop()
+	conn := dialTestServer(t, ro)
+	defer conn.Close()
+
+	rejectedStream(t, ro, conn, bufio.NewReader(conn), "setstream big", ErrReadOnly.Error())
+}
+
+func Test_SetStreamRejectedAuth(t *testing.T) {
+	s, cleanup := newAuthTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	rejectedStream(t, s, conn, r, "setstream big", errAuthRequired.Error())
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn, r, "auth reader secret"))
+	rejectedStream(t, s, conn, r, "setstream tenantA:big", "No permission to run setstream")
+}
+
+func mustReadReply(t *testing.T, r *bufio.Reader) string {
+	reply, err := readReply(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func Test_DefaultMaxValueSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcask-server")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := NewServer(&config.BitcaskConfig{Host: "127.0.0.1", DataDir: dir, DataSize: 1})
+	assert.Nil(t, err)
+	defer s.Stop()
+
+	assert.Equal(t, int64(config.DefaultMaxValueSize), s.maxValueSize)
+	assert.Nil(t, s.Set([]byte("foo"), []byte("bar")), "Expected values to be allowed without max_value_size_in_bytes")
+}
@@ -0,0 +1,171 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SlowLogEntry describes one command exceeding the slowlog threshold
+type SlowLogEntry struct {
+	ID       uint64
+	Time     time.Time
+	Duration time.Duration
+	Client   string
+	Command  string
+	Key      string
+}
+
+func (e SlowLogEntry) String() string {
+	return fmt.Sprintf("id=%d time=%d duration_us=%d client=%s command=%s key=%s",
+		e.ID, e.Time.Unix(), e.Duration.Microseconds(), e.Client, e.Command, e.Key)
+}
+
+// slowLog keeps the latest slow commands in a fixed size ring buffer
+type slowLog struct {
+	threshold time.Duration // negative disables the log
+
+	mu      sync.Mutex
+	entries []SlowLogEntry
+	next    int // slot for the next entry
+	count   int
+	lastID  uint64
+}
+
+// newSlowLog creates a log of at most maxLen entries, nothing is kept
+// when it's not positive
+func newSlowLog(threshold time.Duration, maxLen int) *slowLog {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	return &slowLog{
+		threshold: threshold,
+		entries:   make([]SlowLogEntry, maxLen),
+	}
+}
+
+// record adds the command to the log if it ran longer than threshold
+func (l *slowLog) record(client string, tokens []string, elapsed time.Duration) {
+	if l.threshold < 0 || elapsed < l.threshold || len(l.entries) == 0 {
+		return
+	}
+	entry := SlowLogEntry{
+		Time:     time.Now(),
+		Duration: elapsed,
+		Client:   client,
+		Command:  tokens[0],
+	}
+	if len(tokens) > 1 {
+		entry.Key = tokens[1]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	entry.ID = l.lastID
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	if l.count < len(l.entries) {
+		l.count++
+	}
+}
+
+// get returns up to n entries, newest first. All entries are
+// returned when n is negative.
+func (l *slowLog) get(n int) []SlowLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n < 0 || n > l.count {
+		n = l.count
+	}
+	result := make([]SlowLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (l.next - i + len(l.entries)) % len(l.entries)
+		result = append(result, l.entries[idx])
+	}
+	return result
+}
+
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.next = 0
+	l.count = 0
+}
+
+// SlowLog returns up to n of the latest slow commands, newest first.
+// All of them are returned when n is negative.
+func (s *Server) SlowLog(n int) []SlowLogEntry {
+	return s.slowLog.get(n)
+}
+
+func (s *Server) processSlowLogCommand(tokens []string) ([]byte, error) {
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	switch tokens[1] {
+	case "get":
+		if len(tokens) > 3 {
+			return nil, errTooManyArgs
+		}
+		n := 10
+		if len(tokens) == 3 {
+			i, err := strconv.Atoi(tokens[2])
+			if err != nil {
+				return nil, fmt.Errorf("Not a valid integer: %s", tokens[2])
+			}
+			n = i
+		}
+		entries := s.slowLog.get(n)
+		lines := make([][]byte, len(entries))
+		for i, e := range entries {
+			lines[i] = []byte(e.String())
+		}
+		return formatList(lines), nil
+	case "len":
+		if len(tokens) > 2 {
+			return nil, errTooManyArgs
+		}
+		return []byte(strconv.Itoa(s.slowLog.len())), nil
+	case "reset":
+		if len(tokens) > 2 {
+			return nil, errTooManyArgs
+		}
+		s.slowLog.reset()
+		return []byte("OK"), nil
+	default:
+		return nil, errUnknownCommand
+	}
+}
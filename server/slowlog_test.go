@@ -0,0 +1,97 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func slowLogCommands(entries []SlowLogEntry) []string {
+	var commands []string
+	for _, e := range entries {
+		commands = append(commands, e.Command+" "+e.Key)
+	}
+	return commands
+}
+
+func Test_SlowLog(t *testing.T) {
+	l := newSlowLog(time.Millisecond, 3)
+	l.record("client", []string{"get", "fast"}, time.Microsecond)
+	assert.Equal(t, 0, l.len(), "Expected commands under the threshold to be skipped")
+
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		l.record("client", []string{"get", key}, 2*time.Millisecond)
+	}
+	assert.Equal(t, 3, l.len(), "Expected the log to be capped")
+	entries := l.get(-1)
+	assert.Equal(t, []string{"get k5", "get k4", "get k3"}, slowLogCommands(entries), "Expected the newest entries first")
+	assert.Equal(t, uint64(5), entries[0].ID)
+	assert.Equal(t, []string{"get k5", "get k4"}, slowLogCommands(l.get(2)))
+	assert.Len(t, l.get(10), 3)
+
+	l.reset()
+	assert.Equal(t, 0, l.len())
+	assert.Empty(t, l.get(-1))
+	l.record("client", []string{"ping"}, 2*time.Millisecond)
+	assert.Equal(t, []string{"ping "}, slowLogCommands(l.get(-1)))
+	assert.Equal(t, uint64(6), l.get(1)[0].ID, "Expected ids to keep increasing after reset")
+
+	disabled := newSlowLog(-1, 3)
+	disabled.record("client", []string{"get", "k"}, time.Hour)
+	assert.Equal(t, 0, disabled.len(), "Expected a negative threshold to disable the log")
+
+	empty := newSlowLog(time.Millisecond, -1)
+	empty.record("client", []string{"get", "k"}, time.Hour)
+	assert.Equal(t, 0, empty.len(), "Expected a negative length to keep nothing")
+	assert.Empty(t, empty.get(-1))
+}
+
+func Test_SlowLogCommand(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	s.slowLog = newSlowLog(0, 10)
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	roundTrip(t, conn, r, "slowlog reset", "set a 1")
+	// getstream replies with chunks rather than a framed reply
+	conn.Write([]byte("getstream a\n"))
+	stream := make([]byte, len("1\n10\n"))
+	_, err := io.ReadFull(r, stream)
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n10\n", string(stream))
+	replies := roundTrip(t, conn, r, "get a", "slowlog len", "slowlog get 10", "slowlog get x", "slowlog bogus")
+	assert.Equal(t, "3", replies[1], "Expected streaming commands to be left out")
+	assert.Contains(t, replies[2], "command=get key=a")
+	assert.NotContains(t, replies[2], "getstream")
+	assert.Equal(t, "Not a valid integer: x", replies[3])
+	assert.Equal(t, errUnknownCommand.Error(), replies[4])
+}
@@ -0,0 +1,363 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Panda-Home/bitcask/data"
+	"github.com/Panda-Home/bitcask/utils"
+)
+
+// streamTimeout bounds how long a streamed transfer may wait for the
+// peer before the connection is given up
+const streamTimeout = 30 * time.Second
+
+var errInvalidChunk = errors.New("Invalid chunk size")
+
+// SetStream sets key to the value read from r until EOF and returns
+// its size. The value is spooled to a temporary file in the data
+// directory, so it's never held in memory. Since its size isn't known
+// up front, it's compressed whenever compression is enabled. It's
+// encrypted when a key is configured.
+func (s *Server) SetStream(key []byte, r io.Reader) (int64, error) {
+	if len(key) == 0 {
+		return 0, errors.New("Key cannot be empty")
+	}
+	if s.IsReadOnly() {
+		return 0, ErrReadOnly
+	}
+	spool, err := ioutil.TempFile(s.dataDir, ".stream-")
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create spool file: %s", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	var (
+		flags uint8
+		keyID uint32
+		// writers closed in order once the value is copied
+		writers []io.WriteCloser
+		w       io.Writer = spool
+	)
+	if s.keyring != nil {
+		ew, err := s.keyring.NewWriter(w, key)
+		if err != nil {
+			return 0, err
+		}
+		flags |= data.FlagEncrypted
+		keyID = s.keyring.PrimaryID()
+		writers = append([]io.WriteCloser{ew}, writers...)
+		w = ew
+	}
+	if s.codec != nil {
+		cw := s.codec.NewWriter(w)
+		flags |= s.codec.Flag()
+		writers = append([]io.WriteCloser{cw}, writers...)
+		w = cw
+	}
+	size, err := io.Copy(w, io.LimitReader(r, s.maxValueSize+1)) // before encoding
+	if err != nil {
+		return 0, err
+	}
+	for _, wc := range writers {
+		if err := wc.Close(); err != nil {
+			return 0, err
+		}
+	}
+	if size > s.maxValueSize {
+		return 0, ErrValueTooLarge
+	}
+	if size == 0 {
+		return 0, errors.New("Value cannot be empty")
+	}
+	stored, err := spool.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if stored > math.MaxUint32 {
+		return 0, ErrValueTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version++
+	entry := &data.Entry{
+		Timestamp: utils.MakeTimestampInMS(),
+		Flags:     flags,
+		KeyID:     keyID,
+		Version:   s.version,
+		KeySize:   uint32(len(key)),
+		ValueSize: uint32(stored),
+		Key:       key,
+	}
+	if flags != 0 {
+		entry.RawSize = uint32(size)
+	}
+	if _, err := spool.Seek(0, 0); err != nil {
+		return 0, err
+	}
+	header, err := entry.DumpHeader(spool)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := spool.Seek(0, 0); err != nil {
+		return 0, err
+	}
+	if _, err := s.logFile.WriteFrom(io.MultiReader(bytes.NewReader(header), spool), entry.Size()); err != nil {
+		return 0, fmt.Errorf("Failed set key value pair: %s", err)
+	}
+	pos := s.logFile.ActiveFilePos() - entry.Size()
+	s.keyDir.SetEntry(key, data.NewKeyDirEntry(s.logFile.ActiveFilepath(), pos, entry))
+	s.appended(entry.Version, s.logFile.ActiveFilepath(), pos, entry.Size())
+	return size, nil
+}
+
+// GetStream writes the value of key to w and returns its size. The
+// checksum is verified as the value is copied, data.ErrChecksumMismatch
+// is returned once the whole value is written if it doesn't match.
+func (s *Server) GetStream(key []byte, w io.Writer) (int64, error) {
+	s.mu.Lock()
+	entry, err := s.keyDir.GetValue(key)
+	if err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	// The file stays readable once open, even if a merge removes it
+	f, err := os.OpenFile(entry.FileID, os.O_RDONLY, 0644)
+	s.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to open file: %s", err)
+	}
+	defer f.Close()
+
+	r, err := data.NewValueReader(f, entry.ValuePos)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to load data from file: %s", err)
+	}
+	dec, err := data.NewDecoder(s.keyring, r.Header(), r)
+	if err != nil {
+		return 0, err
+	}
+	defer dec.Close()
+	n, err := io.Copy(w, dec)
+	if err != nil {
+		return n, err
+	}
+	// The decoder may stop short of the end of the stored value, which
+	// is where the checksum is verified
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// chunkedReader decodes a value sent as chunks, each one is its size
+// in decimal on a line followed by as many bytes. A line break after
+// the bytes is optional. A chunk of size 0 ends the value.
+type chunkedReader struct {
+	r    io.Reader
+	left int64 // bytes left in the current chunk
+	err  error
+}
+
+func newChunkedReader(r io.Reader) *chunkedReader {
+	return &chunkedReader{r: r}
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+	if cr.left == 0 {
+		size, err := cr.readSize()
+		if err != nil {
+			cr.err = err
+			return 0, err
+		}
+		if size == 0 {
+			cr.err = io.EOF
+			return 0, io.EOF
+		}
+		cr.left = size
+	}
+	if int64(len(p)) > cr.left {
+		p = p[:cr.left]
+	}
+	n, err := cr.r.Read(p)
+	cr.left -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	cr.err = err
+	return n, err
+}
+
+// readSize reads a chunk size line one byte at a time, so that
+// nothing past the last chunk is consumed from the connection
+func (cr *chunkedReader) readSize() (int64, error) {
+	var (
+		line []byte
+		b    = make([]byte, 1)
+	)
+	for {
+		if _, err := io.ReadFull(cr.r, b); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if b[0] == '\n' {
+			if len(bytes.TrimSpace(line)) == 0 {
+				// line break after the previous chunk
+				line = line[:0]
+				continue
+			}
+			break
+		}
+		if len(line) > 20 {
+			return 0, errInvalidChunk
+		}
+		line = append(line, b[0])
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(line)), 10, 64)
+	if err != nil || size < 0 {
+		return 0, errInvalidChunk
+	}
+	return size, nil
+}
+
+// chunkedWriter encodes each write as one chunk, Close writes the
+// final empty chunk
+type chunkedWriter struct {
+	w *bufio.Writer
+}
+
+func newChunkedWriter(w io.Writer) *chunkedWriter {
+	return &chunkedWriter{w: bufio.NewWriter(w)}
+}
+
+func (cw *chunkedWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(cw.w, "%d\n", len(p)); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// Flush sends buffered chunks without ending the value
+func (cw *chunkedWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+func (cw *chunkedWriter) Close() error {
+	if _, err := cw.w.WriteString("0\n"); err != nil {
+		return err
+	}
+	return cw.w.Flush()
+}
+
+// streamConn reads and writes through the buffers of a client and
+// pushes the deadlines of its connection forward every time, so that
+// a long but active transfer is only cut when it stalls
+type streamConn struct {
+	c *client
+}
+
+func (sc streamConn) Read(p []byte) (int, error) {
+	sc.c.conn.SetReadDeadline(time.Now().Add(streamTimeout))
+	return sc.c.r.Read(p)
+}
+
+// Write sends p right away, along with replies buffered before it
+func (sc streamConn) Write(p []byte) (int, error) {
+	sc.c.conn.SetWriteDeadline(time.Now().Add(streamTimeout))
+	n, err := sc.c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, sc.c.w.Flush()
+}
+
+// processSetStreamCommand handles setstream <key>, the value follows
+// the command line as chunks
+func (s *Server) processSetStreamCommand(c *client, tokens []string) ([]byte, error) {
+	if len(tokens) > 2 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	// what's left of the value when it fails is skipped by execute
+	if _, err := s.SetStream([]byte(tokens[1]), c.body); err != nil {
+		return nil, err
+	}
+	return []byte("OK"), nil
+}
+
+// processGetStreamCommand handles getstream <key>, the value is sent
+// as chunks in place of a reply. An error past the first chunk is sent
+// in place of the next chunk size, followed by a line break.
+func (s *Server) processGetStreamCommand(c *client, tokens []string) ([]byte, error) {
+	if len(tokens) > 2 {
+		return nil, errTooManyArgs
+	}
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	w := newChunkedWriter(streamConn{c})
+	n, err := s.GetStream([]byte(tokens[1]), w)
+	if err != nil {
+		if n == 0 {
+			return nil, err
+		}
+		c.replied = true
+		w.w.WriteString(err.Error() + "\n")
+		if ferr := w.Flush(); ferr != nil {
+			c.closing = true
+		}
+		return nil, err
+	}
+	c.replied = true
+	if err := w.Close(); err != nil {
+		c.closing = true
+		return nil, err
+	}
+	return nil, nil
+}
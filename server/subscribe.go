@@ -0,0 +1,306 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Panda-Home/bitcask/data"
+	"github.com/Panda-Home/bitcask/logging"
+)
+
+// subscriptionBuffer is how many events a subscription holds before
+// its feed waits for them to be received
+const subscriptionBuffer = 128
+
+var (
+	// ErrSubscriptionBehind is returned when the writes a subscription
+	// has to send are no longer in the replication backlog
+	ErrSubscriptionBehind = errors.New("Subscription fell behind the replication backlog")
+	errVersionAhead       = errors.New("Version is ahead of the server")
+)
+
+// ChangeEvent is a write to a key seen by a subscription
+type ChangeEvent struct {
+	Version   uint64
+	Key       []byte
+	Timestamp uint64
+	Deleted   bool
+	Value     []byte // only sent on subscriptions with values, nil for deletions
+}
+
+// Subscription streams writes on C, see Server.Subscribe
+type Subscription struct {
+	C <-chan ChangeEvent
+
+	events chan ChangeEvent
+	quit   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// Close stops the subscription, C is closed once it's done
+func (sub *Subscription) Close() {
+	sub.once.Do(func() { close(sub.quit) })
+}
+
+// Err tells why C was closed, it's nil unless the subscription fell
+// behind or failed to read a write. It must be called once C is closed.
+func (sub *Subscription) Err() error {
+	return sub.err
+}
+
+// Version returns the version of the last write
+func (s *Server) Version() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// Subscribe sends the writes to keys starting with prefix on the C
+// channel of the subscription, along with their values if withValues
+// is set. Writes after version since are sent first, so a subscriber
+// can resume from the version of the last event it got, pass
+// Server.Version to only get new writes. Writes are read back from
+// data files through the replication backlog, since has to be within
+// it. C is closed when the subscription is closed, when the server
+// stops and when the subscription falls behind the backlog.
+func (s *Server) Subscribe(prefix []byte, since uint64, withValues bool) (*Subscription, error) {
+	s.mu.Lock()
+	_, ok := s.backlog.since(since)
+	version := s.version
+	s.mu.Unlock()
+	if since > version {
+		return nil, errVersionAhead
+	}
+	if !ok {
+		return nil, ErrSubscriptionBehind
+	}
+	sub := &Subscription{
+		events: make(chan ChangeEvent, subscriptionBuffer),
+		quit:   make(chan struct{}),
+	}
+	sub.C = sub.events
+	go s.feed(sub, prefix, since, withValues)
+	return sub, nil
+}
+
+// feed sends the writes after version since to sub, as they're
+// appended to data files
+func (s *Server) feed(sub *Subscription, prefix []byte, since uint64, withValues bool) {
+	defer close(sub.events)
+	var (
+		f      *os.File
+		fileID string
+	)
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	errClosed := errors.New("closed")
+	for {
+		s.mu.Lock()
+		records, ok := s.backlog.since(since)
+		notify := s.backlog.notify
+		s.mu.Unlock()
+		if !ok {
+			sub.err = ErrSubscriptionBehind
+			return
+		}
+
+		for _, rec := range records {
+			if rec.fileID != fileID {
+				if f != nil {
+					f.Close()
+				}
+				f, fileID = nil, rec.fileID
+				var err error
+				if f, err = os.Open(rec.fileID); err != nil {
+					// merged away
+					sub.err = ErrSubscriptionBehind
+					return
+				}
+			}
+			recBytes := make([]byte, rec.size)
+			if _, err := f.ReadAt(recBytes, rec.pos); err != nil {
+				sub.err = fmt.Errorf("Failed to read file: %s", err)
+				return
+			}
+			err := data.LoadEntries(recBytes, func(entry *data.Entry, offset int64) error {
+				if entry.Flags&data.FlagBatchCommit != 0 || !bytes.HasPrefix(entry.Key, prefix) {
+					return nil
+				}
+				event := ChangeEvent{
+					Version:   entry.Version,
+					Key:       entry.Key,
+					Timestamp: entry.Timestamp,
+					Deleted:   entry.IsTombstone(),
+				}
+				if withValues && !event.Deleted {
+					value, err := entry.DecodedValue(s.keyring)
+					if err != nil {
+						return err
+					}
+					event.Value = value
+				}
+				select {
+				case sub.events <- event:
+					return nil
+				case <-sub.quit:
+					return errClosed
+				case <-s.quit:
+					return errClosed
+				}
+			})
+			if err == errClosed {
+				return
+			}
+			if err != nil {
+				sub.err = err
+				return
+			}
+			since = rec.version
+		}
+
+		select {
+		case <-notify:
+		case <-sub.quit:
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// processSubscribeCommand handles
+// subscribe <prefix> [since <version>] [withvalues], which turns the
+// connection into a stream of events, one per reply, until the client
+// closes it. A prefix of * subscribes to every key.
+func (s *Server) processSubscribeCommand(c *client, tokens []string) ([]byte, error) {
+	if len(tokens) < 2 {
+		return nil, errTooFewArgs
+	}
+	prefix := []byte(tokens[1])
+	if tokens[1] == "*" {
+		prefix = nil
+	}
+	var (
+		since      uint64
+		hasSince   bool
+		withValues bool
+	)
+	for i := 2; i < len(tokens); i++ {
+		switch strings.ToLower(tokens[i]) {
+		case "since":
+			if i+1 >= len(tokens) {
+				return nil, errTooFewArgs
+			}
+			v, err := strconv.ParseUint(tokens[i+1], 10, 64)
+			if err != nil {
+				return nil, errors.New("Invalid version")
+			}
+			since, hasSince = v, true
+			i++
+		case "withvalues":
+			withValues = true
+		default:
+			return nil, fmt.Errorf("Unknown option: %s", tokens[i])
+		}
+	}
+	if !hasSince {
+		since = s.Version()
+	}
+	sub, err := s.Subscribe(prefix, since, withValues)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+
+	c.replied = true
+	c.closing = true
+	if err := s.writeFrame(c, 0, []byte("OK "+strconv.FormatUint(since, 10))); err != nil {
+		return nil, err
+	}
+	if err := s.flush(c); err != nil {
+		return nil, err
+	}
+
+	// Nothing is expected from the client, a read only returns once
+	// it closes the connection
+	gone := make(chan struct{})
+	c.conn.SetReadDeadline(time.Time{})
+	go func() {
+		c.r.ReadByte()
+		close(gone)
+	}()
+
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				if err := sub.Err(); err != nil {
+					logging.Warn("Subscription ended", "client", c.addr, "err", err)
+					s.writeFrame(c, 0, []byte(err.Error()))
+					return nil, err
+				}
+				return nil, nil
+			}
+			if err := s.writeFrame(c, 0, formatChangeEvent(event)); err != nil {
+				return nil, err
+			}
+			if len(sub.C) == 0 {
+				if err := s.flush(c); err != nil {
+					return nil, err
+				}
+			}
+		case <-gone:
+			return nil, nil
+		}
+	}
+}
+
+// formatChangeEvent returns "set <version> <timestamp> <key>" or
+// "del <version> <timestamp> <key>", followed by the value on the next
+// line when it was sent
+func formatChangeEvent(event ChangeEvent) []byte {
+	op := "set"
+	if event.Deleted {
+		op = "del"
+	}
+	b := []byte(fmt.Sprintf("%s %d %d %s", op, event.Version, event.Timestamp, event.Key))
+	if event.Value != nil {
+		b = append(b, '\n')
+		b = append(b, event.Value...)
+	}
+	return b
+}
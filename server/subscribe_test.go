@@ -0,0 +1,140 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveEvents(t *testing.T, sub *Subscription, n int) []ChangeEvent {
+	var events []ChangeEvent
+	for len(events) < n {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				t.Fatalf("Subscription closed: %v", sub.Err())
+			}
+			events = append(events, event)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Expected %d events, got %d", n, len(events))
+		}
+	}
+	return events
+}
+
+func Test_Subscribe(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	assert.Nil(t, s.Set([]byte("user:0"), []byte("before")))
+	since := s.Version()
+	sub, err := s.Subscribe([]byte("user:"), since, true)
+	assert.Nil(t, err)
+	defer sub.Close()
+
+	assert.Nil(t, s.Set([]byte("user:1"), []byte("alice")))
+	assert.Nil(t, s.Set([]byte("other"), []byte("skipped")))
+	assert.Nil(t, s.Del([]byte("user:1")))
+	b := NewWriteBatch()
+	b.Put([]byte("user:2"), []byte("bob"))
+	b.Put([]byte("other"), []byte("skipped"))
+	assert.Nil(t, s.Write(b))
+
+	events := receiveEvents(t, sub, 3)
+	assert.Equal(t, "user:1", string(events[0].Key))
+	assert.Equal(t, "alice", string(events[0].Value))
+	assert.False(t, events[0].Deleted)
+	assert.NotZero(t, events[0].Timestamp)
+	assert.Equal(t, "user:1", string(events[1].Key))
+	assert.True(t, events[1].Deleted)
+	assert.Nil(t, events[1].Value)
+	assert.Equal(t, "user:2", string(events[2].Key))
+	assert.Equal(t, "bob", string(events[2].Value))
+	assert.True(t, events[0].Version < events[1].Version && events[1].Version < events[2].Version)
+
+	// Resuming from an event replays the writes after it
+	resumed, err := s.Subscribe([]byte("user:"), events[0].Version, false)
+	assert.Nil(t, err)
+	defer resumed.Close()
+	replayed := receiveEvents(t, resumed, 2)
+	assert.Equal(t, events[1].Version, replayed[0].Version)
+	assert.Equal(t, events[2].Version, replayed[1].Version)
+	assert.Nil(t, replayed[1].Value, "Expected no values without withValues")
+
+	sub.Close()
+	for range sub.C {
+	}
+	assert.Nil(t, sub.Err())
+
+	_, err = s.Subscribe(nil, s.Version()+1, false)
+	assert.Equal(t, errVersionAhead, err)
+	for i := 0; i < 150; i++ {
+		assert.Nil(t, s.Set([]byte("other"), []byte(fmt.Sprint(i))))
+	}
+	_, err = s.Subscribe(nil, since, false)
+	assert.Equal(t, ErrSubscriptionBehind, err)
+}
+
+func Test_SubscribeCommand(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	fmt.Fprintf(conn, "subscribe * withvalues\n")
+	reply, err := readReply(r)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("OK %d", s.Version()), reply)
+
+	assert.Nil(t, s.Set([]byte("foo"), []byte("multi\nline")))
+	assert.Nil(t, s.Del([]byte("foo")))
+	for _, op := range []string{"set", "del"} {
+		reply, err = readReply(r)
+		assert.Nil(t, err)
+		var (
+			version, ts uint64
+			key         string
+		)
+		n, _ := fmt.Sscanf(reply, op+" %d %d %s", &version, &ts, &key)
+		assert.Equal(t, 3, n, "Unexpected event %q", reply)
+		assert.Equal(t, "foo", key)
+		if op == "set" {
+			assert.Contains(t, reply, "foo\nmulti\nline")
+		}
+	}
+
+	// Closing the connection ends the subscription
+	conn.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for s.clients.len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, s.clients.len())
+}
@@ -0,0 +1,221 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/Panda-Home/bitcask/logging"
+)
+
+const (
+	// tlsReloadInterval is how often certificate files are checked
+	// for changes, at most once per handshake
+	tlsReloadInterval = time.Second
+	// handshakeTimeout bounds the TLS handshake of new connections
+	handshakeTimeout = 10 * time.Second
+)
+
+// tlsReloader builds the TLS configuration from files and builds it
+// again once any of them changes, so that certificates can be renewed
+// without a restart
+type tlsReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	minVersion   uint16
+
+	mu       sync.Mutex
+	config   *tls.Config
+	modTimes []time.Time
+	checked  time.Time
+}
+
+func newTLSReloader(c *config.BitcaskConfig) (*tlsReloader, error) {
+	if c.TLSKeyFile == "" {
+		return nil, errors.New("tls_key_file is required along with tls_cert_file")
+	}
+	minVersion, err := parseTLSVersion(c.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	r := &tlsReloader{
+		certFile:     c.TLSCertFile,
+		keyFile:      c.TLSKeyFile,
+		clientCAFile: c.TLSClientCAFile,
+		minVersion:   minVersion,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// serverConfig returns the configuration to give to tls.NewListener
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{GetConfigForClient: r.getConfig}
+}
+
+func (r *tlsReloader) getConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= tlsReloadInterval {
+		r.checked = time.Now()
+		if r.changed() {
+			if err := r.load(); err != nil {
+				// keep serving with the previous certificates
+				logging.Error("Failed to reload TLS certificates", "err", err)
+			} else {
+				logging.Info("Reloaded TLS certificates", "cert", r.certFile)
+			}
+		}
+	}
+	return r.config, nil
+}
+
+func (r *tlsReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+// changed tells if any file was modified since it was loaded
+func (r *tlsReloader) changed() bool {
+	for i, path := range r.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			// being replaced, try again later
+			return false
+		}
+		if !info.ModTime().Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *tlsReloader) load() error {
+	// modification times are taken first, so that a file changed
+	// while it's read is loaded again next time
+	var modTimes []time.Time
+	for _, path := range r.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("Failed to read TLS file: %s", err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("Failed to load TLS certificate: %s", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   r.minVersion,
+	}
+	if r.clientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read client CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("No certificate found in client CA file: %s", r.clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	r.config = cfg
+	r.modTimes = modTimes
+	return nil
+}
+
+// parseTLSVersion converts a version such as "1.2" to its tls
+// constant, empty version means 1.2
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("Unknown TLS version: %s", version)
+	}
+}
+
+// newReplicaTLSConfig returns the configuration replicas connect to
+// their primary with, nil when replica_tls isn't set
+func newReplicaTLSConfig(c *config.BitcaskConfig) (*tls.Config, error) {
+	if !c.ReplicaTLS {
+		return nil, nil
+	}
+	cfg := &tls.Config{ServerName: c.ReplicaTLSServerName}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.ReplicaOf)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid replica_of: %s", err)
+		}
+		cfg.ServerName = host
+	}
+	if c.ReplicaTLSCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ReplicaTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read replica CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in replica CA file: %s", c.ReplicaTLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.ReplicaTLSCertFile != "" {
+		if c.ReplicaTLSKeyFile == "" {
+			return nil, errors.New("replica_tls_key_file is required along with replica_tls_cert_file")
+		}
+		cert, err := tls.LoadX509KeyPair(c.ReplicaTLSCertFile, c.ReplicaTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load replica TLS certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,202 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pair tls.Certificate
+}
+
+// newTestCert creates a certificate signed by parent, or self-signed
+// when parent is nil, and writes it along with its key to certFile and
+// keyFile when given
+func newTestCert(t *testing.T, name string, parent *testCert, certFile, keyFile string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if certFile != "" {
+		if err := ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, pair: pair}
+}
+
+func Test_ParseTLSVersion(t *testing.T) {
+	for version, expected := range map[string]uint16{
+		"":    tls.VersionTLS12,
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	} {
+		v, err := parseTLSVersion(version)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, v, "Unexpected version for %q", version)
+	}
+	_, err := parseTLSVersion("1.4")
+	assert.Error(t, err)
+}
+
+// tlsPing runs ping over TLS and returns the reply followed by the
+// name of the server certificate. A command is run after the
+// handshake since that's where a rejected client certificate shows
+// up with TLS 1.3.
+func tlsPing(addr string, cfg *tls.Config) (string, error) {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		return "", err
+	}
+	reply, err := readReply(bufio.NewReader(conn))
+	if err != nil {
+		return "", err
+	}
+	return reply + " " + conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func Test_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcask-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+
+	ca := newTestCert(t, "ca", nil, caFile, filepath.Join(dir, "ca-key.pem"))
+	newTestCert(t, "server1", ca, certFile, keyFile)
+	client := newTestCert(t, "client", ca, "", "")
+
+	s, err := NewServer(&config.BitcaskConfig{
+		Host:            "127.0.0.1",
+		DataDir:         dir,
+		DataSize:        1,
+		MaxValueSize:    1 << 20,
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: caFile,
+	})
+	assert.Nil(t, err)
+	defer s.Stop()
+	addr := s.listeners[0].Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientConfig := &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client.pair}}
+
+	reply, err := tlsPing(addr, clientConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG server1", reply)
+
+	_, err = tlsPing(addr, &tls.Config{RootCAs: roots})
+	assert.Error(t, err, "Expected clients without certificate to be rejected")
+	stranger := newTestCert(t, "stranger", nil, "", "")
+	_, err = tlsPing(addr, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{stranger.pair}})
+	assert.Error(t, err, "Expected certificates from another CA to be rejected")
+	old := clientConfig.Clone()
+	old.MaxVersion = tls.VersionTLS11
+	_, err = tlsPing(addr, old)
+	assert.Error(t, err, "Expected versions under the minimum to be rejected")
+
+	// A renewed certificate is served from the next handshake once
+	// the reload interval is over
+	newTestCert(t, "server2", ca, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	time.Sleep(tlsReloadInterval)
+	reply, err = tlsPing(addr, clientConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG server2", reply)
+
+	// Broken files are ignored and the previous certificate is kept
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte("broken"), 0600))
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+	time.Sleep(tlsReloadInterval)
+	reply, err = tlsPing(addr, clientConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG server2", reply)
+}
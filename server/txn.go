@@ -0,0 +1,164 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"errors"
+)
+
+var (
+	errMultiStarted    = errors.New("Multi already started")
+	errMultiNotStarted = errors.New("No multi started")
+	errWatchInMulti    = errors.New("Watch is not allowed after multi")
+)
+
+// watchedKey is the state of a key when it was watched
+type watchedKey struct {
+	exists  bool
+	version uint64
+}
+
+// Txn is an optimistic transaction. Writes are queued and applied
+// atomically by Commit, only if none of the watched keys has been
+// written or deleted since it was watched.
+type Txn struct {
+	s       *Server
+	watched map[string]watchedKey
+	batch   *WriteBatch
+}
+
+// NewTxn creates a transaction watching no key
+func (s *Server) NewTxn() *Txn {
+	return &Txn{
+		s:       s,
+		watched: make(map[string]watchedKey),
+		batch:   NewWriteBatch(),
+	}
+}
+
+// Watch records the current state of keys. Watching a key again
+// keeps the state recorded first.
+func (t *Txn) Watch(keys ...[]byte) {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := t.watched[string(key)]; ok {
+			continue
+		}
+		var state watchedKey
+		if entry, err := t.s.keyDir.GetValue(key); err == nil {
+			state = watchedKey{exists: true, version: entry.Version}
+		}
+		t.watched[string(key)] = state
+	}
+}
+
+// Put queues setting key to value
+func (t *Txn) Put(key, value []byte) {
+	t.batch.Put(key, value)
+}
+
+// Delete queues deleting key
+func (t *Txn) Delete(key []byte) {
+	t.batch.Delete(key)
+}
+
+// Len returns the number of queued writes
+func (t *Txn) Len() int {
+	return t.batch.Len()
+}
+
+// Commit applies the queued writes as one batch. ErrConditionFailed
+// is returned, and nothing is written, if a watched key changed.
+func (t *Txn) Commit() error {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+
+	for key, state := range t.watched {
+		var current watchedKey
+		if entry, err := t.s.keyDir.GetValue([]byte(key)); err == nil {
+			current = watchedKey{exists: true, version: entry.Version}
+		}
+		if current != state {
+			return ErrConditionFailed
+		}
+	}
+	return t.s.writeBatch(t.batch)
+}
+
+// processTxnCommand handles: watch <key> [<key> ...], unwatch, multi,
+// exec and discard. A transaction ends with exec or discard, which
+// also forget the watched keys.
+func (s *Server) processTxnCommand(c *client, tokens []string) ([]byte, error) {
+	if tokens[0] == "watch" {
+		if len(tokens) < 2 {
+			return nil, errTooFewArgs
+		}
+	} else if len(tokens) > 1 {
+		return nil, errTooManyArgs
+	}
+
+	switch tokens[0] {
+	case "watch":
+		if c.multi {
+			return nil, errWatchInMulti
+		}
+		if c.txn == nil {
+			c.txn = s.NewTxn()
+		}
+		c.txn.Watch(toKeys(tokens[1:])...)
+	case "unwatch":
+		if !c.multi {
+			c.txn = nil
+		}
+	case "multi":
+		if c.multi {
+			return nil, errMultiStarted
+		}
+		if c.batch != nil {
+			return nil, errBatchStarted
+		}
+		if c.txn == nil {
+			c.txn = s.NewTxn()
+		}
+		c.multi = true
+	case "exec":
+		if !c.multi {
+			return nil, errMultiNotStarted
+		}
+		txn := c.txn
+		c.txn, c.multi = nil, false
+		if err := txn.Commit(); err != nil {
+			return nil, err
+		}
+	case "discard":
+		if !c.multi {
+			return nil, errMultiNotStarted
+		}
+		c.txn, c.multi = nil, false
+	}
+	return []byte("OK"), nil
+}
@@ -0,0 +1,105 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Txn(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	assert.Nil(t, s.Set([]byte("a"), []byte("1")))
+
+	txn := s.NewTxn()
+	txn.Watch([]byte("a"), []byte("missing"))
+	txn.Put([]byte("a"), []byte("2"))
+	txn.Delete([]byte("b"))
+	assert.Equal(t, 2, txn.Len())
+	assert.Nil(t, txn.Commit())
+	value, _ := s.Get([]byte("a"))
+	assert.Equal(t, "2", string(value))
+
+	// A watched key written meanwhile fails the transaction
+	txn = s.NewTxn()
+	txn.Watch([]byte("a"))
+	assert.Nil(t, s.Set([]byte("a"), []byte("3")))
+	txn.Put([]byte("a"), []byte("4"))
+	assert.Equal(t, ErrConditionFailed, txn.Commit())
+	value, _ = s.Get([]byte("a"))
+	assert.Equal(t, "3", string(value))
+
+	// So does a missing one which was created, or an existing one
+	// which was deleted
+	txn = s.NewTxn()
+	txn.Watch([]byte("missing"))
+	assert.Nil(t, s.Set([]byte("missing"), []byte("1")))
+	assert.Equal(t, ErrConditionFailed, txn.Commit())
+	txn = s.NewTxn()
+	txn.Watch([]byte("a"))
+	assert.Nil(t, s.Del([]byte("a")))
+	assert.Equal(t, ErrConditionFailed, txn.Commit())
+}
+
+func Test_TxnCommands(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	conn := dialTestServer(t, s)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := roundTrip(t, conn, r, "set a 1", "watch a", "multi", "set a 2", "del b", "exec", "get a")
+	assert.Equal(t, []string{"OK", "OK", "OK", "QUEUED", "QUEUED", "OK", "2"}, replies)
+
+	// A write from another client fails exec
+	other := dialTestServer(t, s)
+	defer other.Close()
+	replies = roundTrip(t, conn, r, "watch a", "multi", "set a 3")
+	assert.Equal(t, []string{"OK", "OK", "QUEUED"}, replies)
+	assert.Equal(t, []string{"OK"}, roundTrip(t, other, bufio.NewReader(other), "set a 4"))
+	replies = roundTrip(t, conn, r, "exec", "get a")
+	assert.Equal(t, []string{ErrConditionFailed.Error(), "4"}, replies)
+
+	// Writes which can't be queued are rejected rather than applied
+	// outside of the transaction, and discard drops the queued ones
+	replies = roundTrip(t, conn, r,
+		"watch a", "multi", "incr a", "mset x 1 y 2", "append a zz", "cas a 1 5", "set c 1", "discard",
+		"get a", "get x", "get c")
+	assert.Equal(t, []string{"OK", "OK",
+		errNotQueueable.Error(), errNotQueueable.Error(), errNotQueueable.Error(), errNotQueueable.Error(), "QUEUED", "OK",
+		"4", "Key not found: x", "Key not found: c"}, replies)
+
+	// discard forgot the watched keys, so this exec succeeds
+	assert.Equal(t, []string{"OK"}, roundTrip(t, other, bufio.NewReader(other), "set a 5"))
+	replies = roundTrip(t, conn, r, "multi", "set a 6", "exec", "get a")
+	assert.Equal(t, []string{"OK", "QUEUED", "OK", "6"}, replies)
+
+	replies = roundTrip(t, conn, r, "exec", "discard", "multi", "multi", "watch a", "batch begin", "discard")
+	assert.Equal(t, []string{errMultiNotStarted.Error(), errMultiNotStarted.Error(), "OK",
+		errMultiStarted.Error(), errWatchInMulti.Error(), errMultiStarted.Error(), "OK"}, replies)
+}
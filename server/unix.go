@@ -0,0 +1,128 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// listenUnix listens on the Unix socket at path with the permissions
+// perm, given in octal. A socket file left behind by a server which
+// didn't stop cleanly is removed, one still in use is kept.
+func listenUnix(path, perm string) (net.Listener, error) {
+	mode := os.FileMode(0660)
+	if perm != "" {
+		m, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil || m > 0777 {
+			return nil, fmt.Errorf("Invalid unix_socket_permissions: %s", perm)
+		}
+		mode = os.FileMode(m)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("Not a socket: %s", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Socket is in use: %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("Failed to remove stale socket: %s", err)
+		}
+	}
+
+	// The socket is bound in a directory only the server can reach and
+	// moved into place once its permissions are set, so it's never
+	// reachable with the permissions given by the umask.
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".bitcask-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmpPath := filepath.Join(dir, filepath.Base(path))
+	l, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("Failed to set socket permissions: %s", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	// the socket file is removed from path when the server stops
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	return &unixListener{Listener: l, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+// unixListener reports the path the socket was moved to as the local
+// address of its connections, rather than the one it was bound to.
+type unixListener struct {
+	net.Listener
+	addr *net.UnixAddr
+}
+
+func (l *unixListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &unixConn{Conn: conn, addr: l.addr}, nil
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return l.addr
+}
+
+type unixConn struct {
+	net.Conn
+	addr *net.UnixAddr
+}
+
+func (c *unixConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// clientAddr names the peer of conn. Unix socket peers have no
+// address, they are told apart by the id of their client instead,
+// which is left out until one is given.
+func clientAddr(conn net.Conn, id uint64) string {
+	if conn.LocalAddr().Network() == "unix" {
+		if id == 0 {
+			return "unix:" + conn.LocalAddr().String()
+		}
+		return fmt.Sprintf("unix:%s#%d", conn.LocalAddr(), id)
+	}
+	return conn.RemoteAddr().String()
+}
@@ -0,0 +1,130 @@
+package server
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Panda-Home/bitcask/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func dialUnix(t *testing.T, path string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func Test_UnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcask-unix")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bitcask.sock")
+
+	// a socket left behind by a crashed server is replaced
+	stale, err := net.Listen("unix", path)
+	assert.Nil(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s, err := NewServer(&config.BitcaskConfig{
+		DataDir:               dir,
+		DataSize:              1,
+		MaxValueSize:          1 << 20,
+		UnixSocket:            path,
+		UnixSocketPermissions: "600",
+	})
+	assert.Nil(t, err)
+	assert.Len(t, s.listeners, 1, "Expected to only listen on the socket without a port")
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, _ := ioutil.ReadDir(dir)
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), ".bitcask-"), "Expected the directory the socket was bound in to be removed")
+	}
+
+	_, err = listenUnix(path, "")
+	assert.EqualError(t, err, "Socket is in use: "+path)
+
+	conn1, r1 := dialUnix(t, path)
+	defer conn1.Close()
+	conn2, r2 := dialUnix(t, path)
+	defer conn2.Close()
+	assert.Equal(t, []string{"OK", "v"}, roundTrip(t, conn1, r1, "set k v", "get k"))
+	assert.Equal(t, []string{"v"}, roundTrip(t, conn2, r2, "get k"))
+
+	// every client connected to the socket gets its own address
+	list := roundTrip(t, conn1, r1, "client list")[0]
+	matches := regexp.MustCompile(`id=(\d+) addr=(\S+)`).FindAllStringSubmatch(list, -1)
+	assert.Len(t, matches, 2)
+	for _, m := range matches {
+		assert.Equal(t, "unix:"+path+"#"+m[1], m[2])
+	}
+
+	assert.Equal(t, []string{"OK"}, roundTrip(t, conn1, r1, "client kill "+matches[1][2]))
+	_, err = readReply(r2)
+	assert.Error(t, err, "Expected the killed client to be disconnected")
+	assert.Equal(t, []string{"v"}, roundTrip(t, conn1, r1, "get k"), "Expected other clients of the socket to be left alone")
+
+	s.Stop()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "Expected the socket to be removed on stop")
+}
+
+func Test_UnixSocketPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcask-unix")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bitcask.sock")
+
+	_, err = listenUnix(path, "999")
+	assert.EqualError(t, err, "Invalid unix_socket_permissions: 999")
+
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+	_, err = listenUnix(path, "")
+	assert.EqualError(t, err, "Not a socket: "+path)
+	os.Remove(path)
+
+	l, err := listenUnix(path, "")
+	assert.Nil(t, err)
+	defer l.Close()
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm(), "Expected 0660 by default")
+	assert.Equal(t, path, l.Addr().String())
+}
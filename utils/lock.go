@@ -0,0 +1,94 @@
+package utils
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned when another process holds a lock
+var ErrLocked = errors.New("File is locked by another process")
+
+// FileLock is an advisory lock held on a file until Unlock or the
+// process exits
+type FileLock struct {
+	f *os.File
+}
+
+// LockFile takes a lock on path. An exclusive lock conflicts with any
+// other lock, shared locks only with exclusive ones. It fails right
+// away with ErrLocked on conflict. The holder of an exclusive lock
+// creates the file if needed and writes its pid to it. Shared locks
+// only open it for reading, so that nothing is written when taking
+// them, and fail with an error satisfying os.IsNotExist when the file
+// doesn't exist.
+func LockFile(path string, exclusive bool) (*FileLock, error) {
+	flag := os.O_RDONLY
+	if exclusive {
+		flag = os.O_RDWR | os.O_CREATE
+	}
+	f, err := os.OpenFile(path, flag, 0644)
+	if os.IsNotExist(err) && !exclusive {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open lock file: %s", err)
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if exclusive {
+		f.Truncate(0)
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	return &FileLock{f: f}, nil
+}
+
+// Unlock releases the lock, the file is left in place since removing
+// it would race with another process locking it
+func (l *FileLock) Unlock() error {
+	if err := unlockFile(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// ReadPid returns the pid written to the file at path, such as a
+// lock file or a pidfile, 0 if there's none
+func ReadPid(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return pid
+}
@@ -0,0 +1,73 @@
+package utils
+
+// The following code was sourced and modified from the
+// https://github.com/Panda-Home/go-bitcask package
+// governed by the following license:
+//
+// Copyright (c) 2020 Panda-Home
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitcask-lock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lock")
+
+	_, err = LockFile(path, false)
+	assert.True(t, os.IsNotExist(err), "Expected shared locks not to create the file")
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	lock, err := LockFile(path, true)
+	assert.Nil(t, err, "Expected no error on first lock")
+	assert.Equal(t, os.Getpid(), ReadPid(path))
+	_, err = LockFile(path, true)
+	assert.Equal(t, ErrLocked, err, "Expected exclusive locks to conflict")
+	_, err = LockFile(path, false)
+	assert.Equal(t, ErrLocked, err, "Expected a shared lock to conflict with an exclusive one")
+	assert.Nil(t, lock.Unlock())
+
+	shared, err := LockFile(path, false)
+	assert.Nil(t, err)
+	other, err := LockFile(path, false)
+	assert.Nil(t, err, "Expected shared locks not to conflict")
+	_, err = LockFile(path, true)
+	assert.Equal(t, ErrLocked, err, "Expected an exclusive lock to conflict with shared ones")
+	shared.Unlock()
+	other.Unlock()
+
+	lock, err = LockFile(path, true)
+	assert.Nil(t, err, "Expected the lock to be free once released")
+	lock.Unlock()
+}
+
+func Test_ProcessExists(t *testing.T) {
+	assert.True(t, ProcessExists(os.Getpid()))
+	assert.False(t, ProcessExists(0))
+}